@@ -0,0 +1,402 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/kalverra/crazed-nft-fans/config"
+	"github.com/kalverra/crazed-nft-fans/convert"
+	"github.com/kalverra/crazed-nft-fans/export"
+	"github.com/kalverra/crazed-nft-fans/fans"
+	"github.com/kalverra/crazed-nft-fans/president"
+)
+
+// maxRequestBody caps how large of a JSON body the API will read
+const maxRequestBody = 1 << 20
+
+// apiError is the body of every API error response
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// targetResponse describes the gas price the fans are aiming for, and whether it's being held to the floor or peak
+type targetResponse struct {
+	TargetGasPriceGwei float64 `json:"targetGasPriceGwei"`
+	TargetGasPriceWei  string  `json:"targetGasPriceWei"`
+	Clamped            bool    `json:"clamped"`
+}
+
+// bandRequest sets the floor and peak the target gas price is held within
+type bandRequest struct {
+	FloorGwei float64 `json:"floorGwei"`
+	PeakGwei  float64 `json:"peakGwei"`
+}
+
+// bandResponse describes the floor and peak the target gas price is held within
+type bandResponse struct {
+	FloorGwei float64 `json:"floorGwei"`
+	FloorWei  string  `json:"floorWei"`
+	PeakGwei  float64 `json:"peakGwei,omitempty"`
+	PeakWei   string  `json:"peakWei,omitempty"`
+}
+
+// targetRequest sets a new gas price for the fans to aim for
+type targetRequest struct {
+	TargetGasPriceGwei float64 `json:"targetGasPriceGwei"`
+}
+
+// spikeRequest spikes the target gas price for either DurationBlocks or DurationSeconds, wearing off according to
+// Decay. Leaving both durations out makes the spike permanent.
+type spikeRequest struct {
+	Multiplier      float64         `json:"multiplier"`
+	DurationBlocks  uint64          `json:"durationBlocks"`
+	DurationSeconds float64         `json:"durationSeconds"`
+	Decay           president.Decay `json:"decay"`
+}
+
+// spikesResponse lists the active spikes on top of the current target
+type spikesResponse struct {
+	Spikes []president.ActiveSpike `json:"spikes"`
+	targetResponse
+}
+
+// fanCountRequest grows or shrinks the fan club to Count fans
+type fanCountRequest struct {
+	Count *int `json:"count"`
+}
+
+// sendModeRequest changes when fans send their transactions
+type sendModeRequest struct {
+	Mode president.SendMode `json:"mode"`
+}
+
+// sendModeResponse shows when fans send their transactions, and the block interval timers are spread across
+type sendModeResponse struct {
+	Mode                 president.SendMode `json:"mode"`
+	BlockIntervalSeconds float64            `json:"blockIntervalSeconds"`
+}
+
+// pauseResponse shows whether fans are paused
+type pauseResponse struct {
+	Paused bool            `json:"paused"`
+	Phase  president.Phase `json:"phase"`
+}
+
+// statusResponse describes the current state of the simulation
+type statusResponse struct {
+	Phase               president.Phase  `json:"phase"`
+	Paused              bool             `json:"paused"`
+	Fans                int              `json:"fans"`
+	FundedFans          int              `json:"fundedFans"`
+	PendingTransactions int              `json:"pendingTransactions"`
+	LatestBlock         uint64           `json:"latestBlock"`
+	Spend               *president.Spend `json:"spend"`
+	targetResponse
+}
+
+// apiRoutes builds the versioned JSON API
+func apiRoutes(r chi.Router) {
+	r.Get("/target", getTarget)
+	r.Put("/target", putTarget)
+	r.Get("/target/band", getTargetBand)
+	r.Put("/target/band", putTargetBand)
+	r.Post("/spike", postSpike)
+	r.Get("/spikes", getSpikes)
+	r.Delete("/spikes", deleteSpikes)
+	r.Get("/status", getStatus)
+	r.Post("/pause", postPause)
+	r.Post("/resume", postResume)
+	r.Get("/rate", getRate)
+	r.Put("/rate", putRate)
+	r.Get("/send-mode", getSendMode)
+	r.Put("/send-mode", putSendMode)
+	r.Get("/fans", getFans)
+	r.Get("/fans/count", getFanCount)
+	r.Get("/fans/{address}", getFan)
+	r.Get("/fans/{address}/transactions", getFanTransactions)
+	r.Put("/fans/count", putFanCount)
+	r.Get("/latency", getLatency)
+	r.Get("/spend", getSpend)
+	r.Get("/endpoints", getEndpoints)
+	r.Get("/throttle", getThrottle)
+	r.Post("/export", postExport)
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no route for %s %s", r.Method, r.URL.Path))
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed on %s", r.Method, r.URL.Path))
+	})
+}
+
+func getTarget(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, newTargetResponse(president.GasTarget()))
+}
+
+func putTarget(w http.ResponseWriter, r *http.Request) {
+	req := &targetRequest{}
+	if err := readJSON(w, r, req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.TargetGasPriceGwei <= 0 {
+		writeError(w, http.StatusBadRequest, errors.New("targetGasPriceGwei must be greater than 0"))
+		return
+	}
+	target := president.SetGasTarget(convert.GweiToWei(big.NewFloat(req.TargetGasPriceGwei)))
+	writeJSON(w, http.StatusOK, newTargetResponse(target))
+}
+
+func getTargetBand(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, newBandResponse())
+}
+
+func putTargetBand(w http.ResponseWriter, r *http.Request) {
+	req := &bandRequest{}
+	if err := readJSON(w, r, req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	err := president.SetGasTargetBand(
+		convert.GweiToWei(big.NewFloat(req.FloorGwei)),
+		convert.GweiToWei(big.NewFloat(req.PeakGwei)),
+	)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newBandResponse())
+}
+
+func newBandResponse() *bandResponse {
+	floor, peak := president.GasTargetBand()
+	band := &bandResponse{FloorWei: floor.String()}
+	band.FloorGwei, _ = convert.WeiToGwei(floor).Float64()
+	if peak != nil {
+		band.PeakWei = peak.String()
+		band.PeakGwei, _ = convert.WeiToGwei(peak).Float64()
+	}
+	return band
+}
+
+func postSpike(w http.ResponseWriter, r *http.Request) {
+	req := &spikeRequest{}
+	if err := readJSON(w, r, req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Decay == "" {
+		req.Decay = president.DecayInstant
+	}
+	newTarget, err := president.Spike(president.SpikeConfig{
+		Multiplier:     req.Multiplier,
+		DurationBlocks: req.DurationBlocks,
+		Duration:       time.Duration(req.DurationSeconds * float64(time.Second)),
+		Decay:          req.Decay,
+	})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newTargetResponse(newTarget))
+}
+
+func getSpikes(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, &spikesResponse{
+		Spikes:         president.ActiveSpikes(),
+		targetResponse: *newTargetResponse(president.GasTarget()),
+	})
+}
+
+func deleteSpikes(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, newTargetResponse(president.ClearSpikes()))
+}
+
+func getStatus(w http.ResponseWriter, r *http.Request) {
+	summary := president.Summary()
+	writeJSON(w, http.StatusOK, &statusResponse{
+		Phase:               president.CurrentPhase(),
+		Paused:              president.Paused(),
+		Fans:                summary.Fans,
+		FundedFans:          summary.FundedFans,
+		PendingTransactions: summary.PendingTransactions,
+		LatestBlock:         summary.LastBlock,
+		Spend:               summary.Spend,
+		targetResponse:      *newTargetResponse(president.GasTarget()),
+	})
+}
+
+func postPause(w http.ResponseWriter, r *http.Request) {
+	president.Pause()
+	writeJSON(w, http.StatusOK, &pauseResponse{Paused: president.Paused(), Phase: president.CurrentPhase()})
+}
+
+func postResume(w http.ResponseWriter, r *http.Request) {
+	president.Resume()
+	writeJSON(w, http.StatusOK, &pauseResponse{Paused: president.Paused(), Phase: president.CurrentPhase()})
+}
+
+func getRate(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, president.TransactionRate())
+}
+
+func putRate(w http.ResponseWriter, r *http.Request) {
+	req := &fans.RateConfig{}
+	if err := readJSON(w, r, req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := president.SetTransactionRate(*req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, president.TransactionRate())
+}
+
+func getSendMode(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, newSendModeResponse())
+}
+
+func putSendMode(w http.ResponseWriter, r *http.Request) {
+	req := &sendModeRequest{}
+	if err := readJSON(w, r, req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := president.SetSendMode(req.Mode); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newSendModeResponse())
+}
+
+func newSendModeResponse() *sendModeResponse {
+	return &sendModeResponse{
+		Mode:                 president.CurrentSendMode(),
+		BlockIntervalSeconds: president.BlockInterval().Seconds(),
+	}
+}
+
+func getFans(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, president.FanInfos())
+}
+
+func getFan(w http.ResponseWriter, r *http.Request) {
+	fan, ok := president.FanByAddress(chi.URLParam(r, "address"))
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no fan with address %s", chi.URLParam(r, "address")))
+		return
+	}
+	writeJSON(w, http.StatusOK, &president.FanInfo{Info: fan.Info(), Strategy: president.CurrentStrategy()})
+}
+
+func getFanTransactions(w http.ResponseWriter, r *http.Request) {
+	fan, ok := president.FanByAddress(chi.URLParam(r, "address"))
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no fan with address %s", chi.URLParam(r, "address")))
+		return
+	}
+	writeJSON(w, http.StatusOK, fan.Transactions())
+}
+
+func getLatency(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, president.InclusionLatency())
+}
+
+func getSpend(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, president.CurrentSpend())
+}
+
+func getEndpoints(w http.ResponseWriter, r *http.Request) {
+	stats := president.EndpointStats()
+	if stats == nil {
+		stats = []fans.EndpointStats{}
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func getThrottle(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, president.RPCThrottling())
+}
+
+func getFanCount(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, president.FanPopulation())
+}
+
+func putFanCount(w http.ResponseWriter, r *http.Request) {
+	req := &fanCountRequest{}
+	if err := readJSON(w, r, req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Count == nil {
+		writeError(w, http.StatusBadRequest, errors.New("count is required"))
+		return
+	}
+	if err := president.ScaleFans(*req.Count); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, president.FanPopulation())
+}
+
+func postExport(w http.ResponseWriter, r *http.Request) {
+	result, err := export.Run(config.Current.ExportDir)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("error exporting run: %w", err))
+		return
+	}
+	logExport(result)
+	writeJSON(w, http.StatusOK, result)
+}
+
+func newTargetResponse(target *big.Int) *targetResponse {
+	gwei, _ := convert.WeiToGwei(target).Float64()
+	return &targetResponse{
+		TargetGasPriceGwei: gwei,
+		TargetGasPriceWei:  target.String(),
+		Clamped:            president.TargetClamped(),
+	}
+}
+
+// readJSON decodes the request body into v, rejecting unknown fields
+func readJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("error decoding request body: %w", err)
+	}
+	return nil
+}
+
+// writeJSON writes v as the JSON response body with the given status
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	ret, err := json.Marshal(v)
+	if err != nil {
+		log.Error().Err(err).Msg("Error marshaling response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err = w.Write(ret); err != nil {
+		log.Error().Err(err).Msg("Error writing response")
+	}
+}
+
+// writeError writes err as a JSON API error with the given status
+func writeError(w http.ResponseWriter, status int, err error) {
+	if status >= http.StatusInternalServerError {
+		log.Error().Err(err).Int("Status", status).Msg("API error")
+	} else {
+		log.Debug().Err(err).Int("Status", status).Msg("API error")
+	}
+	writeJSON(w, status, &apiError{Error: err.Error()})
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kalverra/crazed-nft-fans/president"
+)
+
+func doRequest(t *testing.T, handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"), "API should always respond with JSON")
+	return rec
+}
+
+func TestAPITarget(t *testing.T) {
+	handler := buildRoutes().Handler
+
+	rec := doRequest(t, handler, http.MethodPut, "/api/v1/target", `{"targetGasPriceGwei": 50}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	target := &targetResponse{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), target))
+	require.Equal(t, 50.0, target.TargetGasPriceGwei)
+	require.Equal(t, "50000000000", target.TargetGasPriceWei)
+
+	rec = doRequest(t, handler, http.MethodGet, "/api/v1/target", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), target))
+	require.Equal(t, 50.0, target.TargetGasPriceGwei)
+}
+
+func TestAPITargetBand(t *testing.T) {
+	handler := buildRoutes().Handler
+	t.Cleanup(func() {
+		require.NoError(t, president.SetGasTargetBand(big.NewInt(1), big.NewInt(1_000_000_000_000_000)))
+	})
+
+	rec := doRequest(t, handler, http.MethodPut, "/api/v1/target/band", `{"floorGwei": 10, "peakGwei": 40}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	band := &bandResponse{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), band))
+	require.Equal(t, 10.0, band.FloorGwei)
+	require.Equal(t, 40.0, band.PeakGwei)
+
+	rec = doRequest(t, handler, http.MethodPut, "/api/v1/target", `{"targetGasPriceGwei": 50}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	target := &targetResponse{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), target))
+	require.Equal(t, 40.0, target.TargetGasPriceGwei, "Target should be held to the peak")
+	require.True(t, target.Clamped, "Response should say the target was clamped")
+
+	rec = doRequest(t, handler, http.MethodPut, "/api/v1/target", `{"targetGasPriceGwei": 20}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), target))
+	require.Equal(t, 20.0, target.TargetGasPriceGwei)
+	require.False(t, target.Clamped)
+}
+
+func TestAPISpike(t *testing.T) {
+	handler := buildRoutes().Handler
+	president.SetGasTarget(big.NewInt(10_000_000_000))
+	t.Cleanup(func() { president.ClearSpikes() })
+
+	rec := doRequest(t, handler, http.MethodPost, "/api/v1/spike", `{"multiplier": 2.5, "durationBlocks": 3}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	target := &targetResponse{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), target))
+	require.Equal(t, 25.0, target.TargetGasPriceGwei)
+
+	rec = doRequest(t, handler, http.MethodGet, "/api/v1/spikes", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	spikes := &spikesResponse{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), spikes))
+	require.Len(t, spikes.Spikes, 1)
+	require.Equal(t, president.DecayInstant, spikes.Spikes[0].Config.Decay)
+
+	rec = doRequest(t, handler, http.MethodDelete, "/api/v1/spikes", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), target))
+	require.Equal(t, 10.0, target.TargetGasPriceGwei)
+}
+
+func TestAPIPause(t *testing.T) {
+	handler := buildRoutes().Handler
+	t.Cleanup(president.Resume)
+
+	rec := doRequest(t, handler, http.MethodPost, "/api/v1/pause", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	paused := &pauseResponse{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), paused))
+	require.True(t, paused.Paused)
+
+	rec = doRequest(t, handler, http.MethodPost, "/api/v1/resume", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), paused))
+	require.False(t, paused.Paused)
+}
+
+func TestAPIErrors(t *testing.T) {
+	handler := buildRoutes().Handler
+
+	tests := []struct {
+		name, method, path, body string
+		status                   int
+	}{
+		{"bad json", http.MethodPut, "/api/v1/target", `{"targetGasPriceGwei":`, http.StatusBadRequest},
+		{"unknown field", http.MethodPut, "/api/v1/target", `{"target": 5}`, http.StatusBadRequest},
+		{"negative target", http.MethodPut, "/api/v1/target", `{"targetGasPriceGwei": -5}`, http.StatusBadRequest},
+		{"zero multiplier", http.MethodPost, "/api/v1/spike", `{"durationBlocks": 1}`, http.StatusBadRequest},
+		{"unknown decay", http.MethodPost, "/api/v1/spike", `{"multiplier": 2, "durationBlocks": 1, "decay": "wobbly"}`, http.StatusBadRequest},
+		{"two durations", http.MethodPost, "/api/v1/spike", `{"multiplier": 2, "durationBlocks": 1, "durationSeconds": 5}`, http.StatusBadRequest},
+		{"unknown route", http.MethodGet, "/api/v1/nope", "", http.StatusNotFound},
+		{"unknown fan", http.MethodGet, "/api/v1/fans/0x0000000000000000000000000000000000000042", "", http.StatusNotFound},
+		{"unknown fan transactions", http.MethodGet, "/api/v1/fans/0x42/transactions", "", http.StatusNotFound},
+		{"floor above peak", http.MethodPut, "/api/v1/target/band", `{"floorGwei": 50, "peakGwei": 10}`, http.StatusBadRequest},
+		{"wrong method", http.MethodDelete, "/api/v1/target", "", http.StatusMethodNotAllowed},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			rec := doRequest(t, handler, test.method, test.path, test.body)
+			require.Equal(t, test.status, rec.Code, rec.Body.String())
+			apiErr := &apiError{}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), apiErr))
+			require.NotEmpty(t, apiErr.Error, "Error response should have a message")
+		})
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/kalverra/crazed-nft-fans/config"
+	"github.com/kalverra/crazed-nft-fans/export"
+	"github.com/kalverra/crazed-nft-fans/president"
+)
+
+// command is one of the binary's subcommands
+type command struct {
+	name  string
+	args  string // Positional arguments the command takes
+	usage string
+	run   func(ctx context.Context, fs *flag.FlagSet) error
+}
+
+var commands = []*command{
+	{name: "run", usage: "Recruit and fund fans, then have them chase the target gas price until stopped", run: runCommand},
+	{name: "replay", args: "<csv>", usage: "Run, setting the target gas price to each block's average_gwei_paid in a historical CSV", run: replayCommand},
+	{name: "scenario", args: "<file>", usage: "Run, working through the steps of a JSON scenario file", run: scenarioCommand},
+	{name: "fund", usage: "Recruit fans up to --fans, saving their keys to --fan-keys, and fund them", run: fundCommand},
+	{name: "sweep", usage: "Send everything the fans saved in --fan-keys have left back to the funding address", run: sweepCommand},
+	{name: "status", usage: "Show the status of a running instance", run: statusCommand},
+}
+
+// runCLI runs the subcommand named by the first argument, defaulting to run
+func runCLI(ctx context.Context, args []string) error {
+	name := "run"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		printUsage(os.Stdout)
+		return nil
+	}
+	cmd := findCommand(name)
+	if cmd == nil {
+		printUsage(os.Stderr)
+		return fmt.Errorf("unknown command '%s'", name)
+	}
+
+	fs, err := parseFlags(cmd, args)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return cmd.run(ctx, fs)
+}
+
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// parseFlags parses a command's flags over the current config
+func parseFlags(cmd *command, args []string) (*flag.FlagSet, error) {
+	configFile := config.Current.ConfigFile
+	fs, err := parseFlagSet(cmd, args)
+	if err != nil {
+		return nil, err
+	}
+	// A config file named by a flag goes under env vars and the other flags, so read it then parse the flags again
+	if config.Current.ConfigFile != configFile {
+		if err = config.ReadConfigFile(config.Current.ConfigFile); err != nil {
+			return nil, err
+		}
+		if fs, err = parseFlagSet(cmd, args); err != nil {
+			return nil, err
+		}
+	}
+	wantArgs := 0
+	if cmd.args != "" {
+		wantArgs = 1
+	}
+	if fs.NArg() != wantArgs {
+		fs.Usage()
+		return nil, fmt.Errorf("%s takes %d argument(s), got %d", cmd.name, wantArgs, fs.NArg())
+	}
+	if err := config.Current.Refresh(); err != nil {
+		return nil, err
+	}
+	return fs, config.InitLogging(config.Current.LogLevel)
+}
+
+func parseFlagSet(cmd *command, args []string) (*flag.FlagSet, error) {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: crazed-nft-fans %s [flags] %s\n\n%s\n\nFlags:\n", cmd.name, cmd.args, cmd.usage)
+		fs.PrintDefaults()
+	}
+	config.Current.AddFlags(fs)
+	return fs, fs.Parse(args)
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: crazed-nft-fans <command> [flags] [args]")
+	fmt.Fprintln(w, "\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-9s %-6s %s\n", cmd.name, cmd.args, cmd.usage)
+	}
+	fmt.Fprintln(w, "\nRun 'crazed-nft-fans <command> -h' to see a command's flags, which override env vars.")
+}
+
+func runCommand(ctx context.Context, fs *flag.FlagSet) error {
+	return simulate(ctx, nil)
+}
+
+func replayCommand(ctx context.Context, fs *flag.FlagSet) error {
+	targets, err := president.LoadReplay(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return simulate(ctx, func(ctx context.Context) error {
+		select {
+		case <-president.Replay(targets):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+func scenarioCommand(ctx context.Context, fs *flag.FlagSet) error {
+	scenario, err := president.LoadScenario(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return simulate(ctx, scenario.Run)
+}
+
+func fundCommand(ctx context.Context, fs *flag.FlagSet) error {
+	if config.Current.FanKeysFile == "" {
+		return errors.New("fund needs FAN_KEYS_FILE or --fan-keys to save the fans' keys to, or their ETH can't be swept back")
+	}
+	return withChain(ctx, func(ctx context.Context) error {
+		if err := joinFans(ctx); err != nil {
+			return err
+		}
+		return president.FundFans(ctx, config.Current.FundAmountWei)
+	})
+}
+
+func sweepCommand(ctx context.Context, fs *flag.FlagSet) error {
+	if config.Current.FanKeysFile == "" {
+		return errors.New("sweep needs FAN_KEYS_FILE or --fan-keys to know which fans to sweep")
+	}
+	return withChain(ctx, func(ctx context.Context) error {
+		if _, err := president.LoadFans(ctx); err != nil {
+			return err
+		}
+		return president.SweepFans(ctx)
+	})
+}
+
+func statusCommand(ctx context.Context, fs *flag.FlagSet) error {
+	address := config.Current.ListenAddress
+	if strings.HasPrefix(address, ":") {
+		address = "localhost" + address
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+address+"/api/v1/status", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error reaching crazed-nft-fans at %s, is it running? %w", address, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status request failed with %s", resp.Status)
+	}
+
+	status := map[string]any{}
+	if err = json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return err
+	}
+	out, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+// joinFans loads any saved fans, then recruits new ones until there are as many as configured
+func joinFans(ctx context.Context) error {
+	president.SetPhase(president.PhaseRecruiting)
+	loaded, err := president.LoadFans(ctx)
+	if err != nil {
+		return err
+	}
+	if loaded >= config.Current.FanCount {
+		return nil
+	}
+	return president.RecruitFans(ctx, config.Current.FanCount-loaded)
+}
+
+// withChain watches the chain with fans paused, so their funding and sweeping transactions confirm, while fn runs
+func withChain(ctx context.Context, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	president.Pause()
+	if err := president.WatchChain(ctx); err != nil {
+		return err
+	}
+	err := fn(ctx)
+	cancel()
+	president.Wait()
+	president.CloseEndpoints()
+	if closeErr := president.CloseBlockHistory(); closeErr != nil {
+		log.Error().Err(closeErr).Msg("Error closing block history")
+	}
+	return err
+}
+
+// simulate serves the dashboard and has fans chase the target gas price until ctx is done, or drive returns
+func simulate(ctx context.Context, drive func(ctx context.Context) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	router := buildRoutes()
+	go func() {
+		log.Info().Msgf("Starting at http://%s", router.Addr)
+		if err := router.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal().Err(err).Msg("Error running router")
+		}
+	}()
+
+	if err := president.WatchChain(ctx); err != nil {
+		return fmt.Errorf("error watching chain: %w", err)
+	}
+	if err := joinFans(ctx); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("error recruiting fans: %w", err)
+	}
+	president.SetPhase(president.PhaseFunding)
+	err := president.FundFans(ctx, config.Current.FundAmountWei)
+	switch {
+	case errors.Is(err, president.ErrSpendCapReached):
+		log.Warn().Err(err).Msg("Spend cap reached before every fan was funded, running with the fans that were")
+	case err != nil && ctx.Err() == nil:
+		return fmt.Errorf("error funding fans: %w", err)
+	}
+
+	president.SetPhase(president.PhaseRunning)
+	if drive != nil {
+		go func() {
+			defer cancel()
+			if err := drive(ctx); err != nil && ctx.Err() == nil {
+				log.Error().Err(err).Msg("Error driving the fans")
+			}
+		}()
+	}
+	<-ctx.Done()
+	log.Info().Msg("Shutting down")
+	president.SetPhase(president.PhaseStopping)
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+	if err := router.Shutdown(shutdownCtx); err != nil {
+		log.Error().Err(err).Msg("Error shutting down router")
+	}
+	president.Wait()
+	president.CloseEndpoints()
+	if config.Current.ExportOnShutdown {
+		result, err := export.Run(config.Current.ExportDir)
+		if err != nil {
+			log.Error().Err(err).Msg("Error exporting run")
+		} else {
+			logExport(result)
+		}
+	}
+	if err := president.CloseBlockHistory(); err != nil {
+		log.Error().Err(err).Msg("Error closing block history")
+	}
+	president.Summary().Log()
+	return nil
+}
+
+// logExport logs the files an export wrote, warning if fans had already forgotten some of their transactions
+func logExport(result *export.Result) {
+	if result.ForgottenTransactions > 0 {
+		log.Warn().Strs("Files", result.Files).Int("Forgotten Transactions", result.ForgottenTransactions).
+			Msg("Exported run, leaving out transactions older than each fan's last TX_HISTORY_SIZE")
+		return
+	}
+	log.Info().Strs("Files", result.Files).Msg("Exported run")
+}
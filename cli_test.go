@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kalverra/crazed-nft-fans/config"
+)
+
+func TestParseFlags(t *testing.T) {
+	original := *config.Current
+	t.Cleanup(func() { *config.Current = original })
+
+	fs, err := parseFlags(findCommand("replay"), []string{"--fans", "5", "--fund-amount", "2", "--listen", ":4444", "kitties.csv"})
+	require.NoError(t, err, "Error parsing flags")
+	require.Equal(t, "kitties.csv", fs.Arg(0))
+	require.Equal(t, 5, config.Current.FanCount)
+	require.Equal(t, ":4444", config.Current.ListenAddress)
+	require.Equal(t, new(big.Int).Mul(big.NewInt(2), big.NewInt(1e18)), config.Current.FundAmountWei, "Derived config should be refreshed")
+
+	_, err = parseFlags(findCommand("replay"), []string{})
+	require.Error(t, err, "replay without a CSV should error")
+	_, err = parseFlags(findCommand("run"), []string{"--fans", "lots"})
+	require.Error(t, err, "Bad flag value should error")
+}
+
+func TestCommandsNeedFanKeys(t *testing.T) {
+	original := *config.Current
+	t.Cleanup(func() { *config.Current = original })
+	config.Current.FanKeysFile = ""
+
+	for _, name := range []string{"fund", "sweep"} {
+		fs, err := parseFlags(findCommand(name), []string{})
+		require.NoError(t, err, "Error parsing flags")
+		require.ErrorContains(t, findCommand(name).run(context.Background(), fs), "FAN_KEYS_FILE",
+			"%s shouldn't touch the chain without somewhere to keep the fans' keys", name)
+	}
+}
@@ -5,9 +5,9 @@ import (
 	"crypto/ecdsa"
 	"math/big"
 	"os"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -20,44 +20,149 @@ var Current *Config
 
 // Config details the config for the project
 type Config struct {
-	HTTP    string `envconfig:"http_url" default:"http://localhost:8545"` // HTTP URL of the chain
-	WS      string `envconfig:"ws_url" default:"ws://localhost:8546"`     // Websocket URL of the chain
-	ChainID uint64 `envconfig:"chain_id" default:"1337"`                  // ID of the chain
+	// ConfigFile is an optional YAML file to read settings from, which env vars and flags take precedence over
+	ConfigFile string `envconfig:"config_file"`
+	HTTP       string `envconfig:"http_url" default:"http://localhost:8545"` // HTTP URL of the chain
+	WS         string `envconfig:"ws_url" default:"ws://localhost:8546"`     // Websocket URL of the chain
+	ChainID    uint64 `envconfig:"chain_id" default:"1337"`                  // ID of the chain
+	// FanRPCURLs are nodes for fans to send their transactions through, instead of all going through WS. FanRPCMode
+	// "pinned" sticks each fan to one of them in turn, "round-robin" has each transaction go to the next one.
+	FanRPCURLs []string `envconfig:"fan_rpc_urls"`
+	FanRPCMode string   `envconfig:"fan_rpc_mode" default:"pinned"`
+	// RPC calls made for every block, the fans' and our own, are held to RPCRateLimit a second in bursts of up to
+	// RPCBurst, with no more than RPCMaxConcurrent in flight. 0 turns the rate or concurrency limit off.
+	RPCRateLimit     float64 `envconfig:"rpc_rate_limit" default:"0"`
+	RPCBurst         int     `envconfig:"rpc_burst" default:"20"`
+	RPCMaxConcurrent int     `envconfig:"rpc_max_concurrent" default:"0"`
 	// Funding Key is the main key to fund fans from. Default is the default used by geth, hardhat, ganache, etc...
 	FundingKey        string  `envconfig:"funding_key" default:"ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80"`
 	PeakGasPriceGwei  float64 `envconfig:"peak_gas_price" default:"100"` // Target gas price in Gwei
 	FloorGasPriceGwei float64 `envconfig:"floor_gas_price" default:"10"` // Target gas price in Gwei
 	LogLevel          string  `envconfig:"log_level" default:"debug"`
+	ListenAddress     string  `envconfig:"listen_address" default:":3333"` // Address to serve the dashboard and API on
+	FanCount          int     `envconfig:"fan_count" default:"100"`        // How many fans to start with
+	FundAmountEther   float64 `envconfig:"fund_amount" default:"100"`      // How much ETH to fund each fan with
+	// Instead of FundingKey, the funder can be an encrypted JSON keystore file along with a file holding its password,
+	// or FundingAccount signing through a Clef compatible external signer at FundingSignerURL
+	FundingKeystore     string `envconfig:"funding_keystore"`
+	FundingPasswordFile string `envconfig:"funding_password_file"`
+	FundingSignerURL    string `envconfig:"funding_signer_url"`
+	FundingAccount      string `envconfig:"funding_account"`
+	// Fans are topped up when their balance drops below enough for RefundLeadBlocks blocks at their recent spend rate,
+	// or RefundThresholdEther, whichever is higher. They're sent enough for RefundTopUpBlocks blocks, up to FundAmount.
+	RefundThresholdEther float64 `envconfig:"refund_threshold" default:"1"`
+	RefundLeadBlocks     int     `envconfig:"refund_lead_blocks" default:"5"`
+	RefundTopUpBlocks    int     `envconfig:"refund_topup_blocks" default:"50"`
+	// FanKeysFile is an optional file to save fan keys to, so the fund and sweep commands can reach fans from
+	// previous runs, and runs can reuse them
+	FanKeysFile string `envconfig:"fan_keys_file"`
+	// TxRateModel decides how many transactions each fan sends per block, one of "uniform", "fixed", "poisson", or
+	// "fill". TxRate is the max for uniform, the count for fixed, the mean for poisson, and the percent of each block
+	// the fan club fills between them for fill.
+	TxRateModel string  `envconfig:"tx_rate_model" default:"uniform"`
+	TxRate      float64 `envconfig:"tx_rate" default:"20"`
+	// SendMode is when fans send transactions, "block" sends them all right after each block, "timer" has each fan
+	// send on its own random timer spread across the block interval
+	SendMode string `envconfig:"send_mode" default:"block"`
+	// ExpectedBlockTime is the block interval to assume until enough blocks have been seen to measure it
+	ExpectedBlockTime time.Duration `envconfig:"expected_block_time" default:"12s"`
+	// The default spike used by the dashboard's spike button. Lasts for SpikeDurationBlocks blocks, or SpikeDuration
+	// if that's set instead, with SpikeDecay being one of "instant", "linear", or "exponential".
+	SpikeMultiplier     float64       `envconfig:"spike_multiplier" default:"100"`
+	SpikeDurationBlocks uint64        `envconfig:"spike_duration_blocks" default:"1"`
+	SpikeDuration       time.Duration `envconfig:"spike_duration" default:"0s"`
+	SpikeDecay          string        `envconfig:"spike_decay" default:"instant"`
+	// BlockHistorySize is how many of the most recent blocks to keep in memory
+	BlockHistorySize int `envconfig:"block_history_size" default:"100000"`
+	// BlockHistoryFile is an optional append-only file to persist tracked blocks to, so history survives restarts
+	BlockHistoryFile string `envconfig:"block_history_file"`
+	// TxHistorySize is how many of each fan's most recent transactions to remember
+	TxHistorySize int `envconfig:"tx_history_size" default:"1000"`
+	// FeeHistoryPercentiles are the priority fee percentiles to pull from eth_feeHistory for each block
+	FeeHistoryPercentiles []float64 `envconfig:"fee_history_percentiles" default:"10,25,50,75,90"`
+	// MempoolPollInterval is how often to check the node's txpool, 0 disables mempool monitoring
+	MempoolPollInterval time.Duration `envconfig:"mempool_poll_interval" default:"5s"`
+	// MempoolTipPercentiles are the percentiles of the pending transactions' effective tips to track in the mempool
+	MempoolTipPercentiles []float64 `envconfig:"mempool_tip_percentiles" default:"10,25,50,75,90"`
+	// ExportDir is where run exports are written, and ExportOnShutdown writes one automatically when shutting down
+	ExportDir        string `envconfig:"export_dir" default:"exports"`
+	ExportOnShutdown bool   `envconfig:"export_on_shutdown" default:"false"`
+	// Safety guards. Known public chains, and funders holding more than MaxFundingBalanceEther, are refused unless
+	// AllowPublicChain is set. The default balance is above the 20000 ETH the bundled test node's genesis gives the funder. Funding
+	// stops once SpendCapEther has been sent to fans, 0 for no cap.
+	AllowPublicChain       bool    `envconfig:"allow_public_chain" default:"false"`
+	MaxFundingBalanceEther float64 `envconfig:"max_funding_balance" default:"100000"`
+	SpendCapEther          float64 `envconfig:"spend_cap" default:"0"`
+	// BudgetEther is how much ETH the run can burn on gas and sends to random addresses before the fans are paused,
+	// 0 for no budget
+	BudgetEther float64 `envconfig:"budget" default:"0"`
 
-	FundingPrivateKey *ecdsa.PrivateKey `ignored:"true"` // Transformed private key
-	FundingAddress    common.Address    `ignored:"true"` // Transformed private key to address
-	BigChainID        *big.Int          `ignored:"true"` // ChainID in big.Int format
-	PeakGasPriceWei   *big.Int          `ignored:"true"` // Target gas price in Wei
-	FloorGasPriceWei  *big.Int          `ignored:"true"` // Floor gas price in Wei
+	FundingPrivateKey    *ecdsa.PrivateKey `ignored:"true"` // Transformed private key, nil when using an external signer
+	FundingAddress       common.Address    `ignored:"true"` // Transformed private key to address
+	BigChainID           *big.Int          `ignored:"true"` // ChainID in big.Int format
+	PeakGasPriceWei      *big.Int          `ignored:"true"` // Target gas price in Wei
+	FloorGasPriceWei     *big.Int          `ignored:"true"` // Floor gas price in Wei
+	FundAmountWei        *big.Int          `ignored:"true"` // Fund amount in Wei
+	MaxFundingBalanceWei *big.Int          `ignored:"true"` // Max funding balance in Wei
+	SpendCapWei          *big.Int          `ignored:"true"` // Spend cap in Wei, 0 for no cap
+	RefundThresholdWei   *big.Int          `ignored:"true"` // Refund threshold in Wei
+	BudgetWei            *big.Int          `ignored:"true"` // Budget in Wei, 0 for no budget
 }
 
-// ReadConfig reads in the project config in from env vars
+// ReadConfig reads in the project config from the config file named by CONFIG_FILE, if any, then env vars
 func ReadConfig() error {
-	var err error
+	return ReadConfigFile(os.Getenv("CONFIG_FILE"))
+}
+
+// ReadConfigFile reads in the project config from a YAML config file, with env vars taking precedence over it.
+// An empty path reads env vars alone.
+func ReadConfigFile(path string) error {
+	if path != "" {
+		values, err := readConfigFile(path)
+		if err != nil {
+			return err
+		}
+		restore, err := setUnsetEnv(values)
+		if err != nil {
+			return err
+		}
+		defer restore()
+	}
+
 	var conf Config
-	if err = envconfig.Process("", &conf); err != nil {
+	if err := envconfig.Process("", &conf); err != nil {
 		return err
 	}
-	if err = InitLogging(conf.LogLevel); err != nil {
+	conf.ConfigFile = path
+	if err := conf.Refresh(); err != nil {
 		return err
 	}
+	if err := InitLogging(conf.LogLevel); err != nil {
+		return err
+	}
+	Current = &conf
+	return nil
+}
 
-	conf.FundingPrivateKey, err = crypto.HexToECDSA(conf.FundingKey)
-	if err != nil {
+// Refresh checks the config and recalculates the fields derived from it. Call it after changing any fields, e.g.
+// from command line flags.
+func (c *Config) Refresh() error {
+	if err := c.Validate(); err != nil {
 		return err
 	}
 
-	conf.FundingAddress = crypto.PubkeyToAddress(conf.FundingPrivateKey.PublicKey)
-	conf.PeakGasPriceWei = convert.GweiToWei(big.NewFloat(conf.PeakGasPriceGwei))
-	conf.FloorGasPriceWei = convert.GweiToWei(big.NewFloat(conf.FloorGasPriceGwei))
-	conf.BigChainID = new(big.Int).SetUint64(conf.ChainID)
-	Current = &conf
-	return err
+	if err := c.loadFunder(); err != nil {
+		return err
+	}
+	c.PeakGasPriceWei = convert.GweiToWei(big.NewFloat(c.PeakGasPriceGwei))
+	c.FloorGasPriceWei = convert.GweiToWei(big.NewFloat(c.FloorGasPriceGwei))
+	c.FundAmountWei = convert.EtherToWei(big.NewFloat(c.FundAmountEther))
+	c.MaxFundingBalanceWei = convert.EtherToWei(big.NewFloat(c.MaxFundingBalanceEther))
+	c.SpendCapWei = convert.EtherToWei(big.NewFloat(c.SpendCapEther))
+	c.BudgetWei = convert.EtherToWei(big.NewFloat(c.BudgetEther))
+	c.RefundThresholdWei = convert.EtherToWei(big.NewFloat(c.RefundThresholdEther))
+	c.BigChainID = new(big.Int).SetUint64(c.ChainID)
+	return nil
 }
 
 // InitLogging initializes logging based on the passed in level
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -52,3 +54,58 @@ func TestBadLogLevel(t *testing.T) {
 	err := config.ReadConfig()
 	require.Error(t, err, "Bad funding key should have thrown an error")
 }
+
+func TestBadFeeHistoryPercentiles(t *testing.T) {
+	t.Setenv("FEE_HISTORY_PERCENTILES", "50,10")
+	err := config.ReadConfig()
+	require.Error(t, err, "Descending fee history percentiles should have thrown an error")
+
+	t.Setenv("FEE_HISTORY_PERCENTILES", "10,150")
+	err = config.ReadConfig()
+	require.Error(t, err, "Fee history percentile over 100 should have thrown an error")
+}
+
+func TestConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte(`
+ws_url: wss://node.example.com/ws
+chain_id: 5
+fan-count: 10
+fee_history_percentiles: [5, 50, 95]
+mempool_poll_interval: 10s
+`), 0600)
+	require.NoError(t, err, "Error writing config file")
+	t.Setenv("CHAIN_ID", "420")
+
+	require.NoError(t, config.ReadConfigFile(path), "Error reading config file")
+	require.Equal(t, "wss://node.example.com/ws", config.Current.WS)
+	require.Equal(t, uint64(420), config.Current.ChainID, "Env vars should take precedence over the config file")
+	require.Equal(t, 10, config.Current.FanCount)
+	require.Equal(t, []float64{5, 50, 95}, config.Current.FeeHistoryPercentiles)
+	require.Equal(t, 10*time.Second, config.Current.MempoolPollInterval)
+	_, set := os.LookupEnv("WS_URL")
+	require.False(t, set, "Config file shouldn't leak into the environment")
+
+	require.NoError(t, os.WriteFile(path, []byte("wss_url: typo\n"), 0600))
+	require.Error(t, config.ReadConfigFile(path), "Unknown settings should be rejected")
+}
+
+func TestValidate(t *testing.T) {
+	require.NoError(t, config.ReadConfig(), "Error reading config")
+	conf := *config.Current
+	require.NoError(t, conf.Validate(), "Default config should be valid")
+	require.Equal(t, float64(100000), conf.MaxFundingBalanceEther, "The balance guard should be on by default")
+
+	conf.WS = "http://localhost:8546"
+	conf.FloorGasPriceGwei, conf.PeakGasPriceGwei = 50, 10
+	conf.SendMode = "whenever"
+	conf.MempoolTipPercentiles = []float64{90, 10}
+	conf.MaxFundingBalanceEther = 0
+	err := conf.Validate()
+	require.Error(t, err)
+	require.ErrorContains(t, err, "WS_URL")
+	require.ErrorContains(t, err, "FLOOR_GAS_PRICE")
+	require.ErrorContains(t, err, "MEMPOOL_TIP_PERCENTILES")
+	require.ErrorContains(t, err, "MAX_FUNDING_BALANCE")
+	require.ErrorContains(t, err, "SEND_MODE", "Every problem should be reported at once")
+}
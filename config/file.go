@@ -0,0 +1,81 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// readConfigFile reads a YAML config file, keyed by the same names as the env vars, e.g. "ws_url" or "WS_URL", into
+// the values the env vars would have. Lists become comma separated values.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path) // #nosec G304 - path is operator supplied
+	if err != nil {
+		return nil, err
+	}
+	raw := map[string]any{}
+	if err = yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("error reading config file %s: %w", path, err)
+	}
+
+	known := envKeys()
+	values := make(map[string]string, len(raw))
+	for key, value := range raw {
+		envKey := strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+		if _, ok := known[envKey]; !ok {
+			return nil, fmt.Errorf("unknown setting '%s' in config file %s", key, path)
+		}
+		switch v := value.(type) {
+		case nil:
+			values[envKey] = ""
+		case []any:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				items = append(items, fmt.Sprint(item))
+			}
+			values[envKey] = strings.Join(items, ",")
+		case map[string]any:
+			return nil, fmt.Errorf("setting '%s' in config file %s can't be a map", key, path)
+		default:
+			values[envKey] = fmt.Sprint(v)
+		}
+	}
+	return values, nil
+}
+
+// envKeys lists the env var behind every setting
+func envKeys() map[string]struct{} {
+	keys := map[string]struct{}{}
+	configType := reflect.TypeOf(Config{})
+	for i := 0; i < configType.NumField(); i++ {
+		if tag := configType.Field(i).Tag.Get("envconfig"); tag != "" {
+			keys[strings.ToUpper(tag)] = struct{}{}
+		}
+	}
+	return keys
+}
+
+// setUnsetEnv sets each env var in values that isn't already set, so env vars take precedence over the config file.
+// Call the returned func to unset them again.
+func setUnsetEnv(values map[string]string) (func(), error) {
+	set := []string{}
+	restore := func() {
+		for _, key := range set {
+			_ = os.Unsetenv(key)
+		}
+	}
+	for key, value := range values {
+		if _, ok := os.LookupEnv(key); ok {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			restore()
+			return nil, err
+		}
+		set = append(set, key)
+	}
+	return restore, nil
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"flag"
+	"strings"
+)
+
+// AddFlags registers command line flags that override the config, defaulting to the config's current values.
+// Call Refresh after parsing them.
+func (c *Config) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.ConfigFile, "config", c.ConfigFile, "YAML config file to read settings from, under env vars and flags")
+	fs.StringVar(&c.HTTP, "http-url", c.HTTP, "HTTP URL of the chain")
+	fs.StringVar(&c.WS, "ws-url", c.WS, "Websocket URL of the chain")
+	fs.Uint64Var(&c.ChainID, "chain-id", c.ChainID, "ID of the chain")
+	fs.Func("fan-rpc-urls", "Comma separated nodes for fans to send transactions through, instead of --ws-url",
+		func(urls string) error {
+			c.FanRPCURLs = nil
+			if urls != "" {
+				c.FanRPCURLs = strings.Split(urls, ",")
+			}
+			return nil
+		})
+	fs.Float64Var(&c.RPCRateLimit, "rpc-rate", c.RPCRateLimit, "Most RPC calls a second to make for each block, 0 for no limit")
+	fs.IntVar(&c.RPCBurst, "rpc-burst", c.RPCBurst, "How many RPC calls can go at once before the rate limit kicks in")
+	fs.IntVar(&c.RPCMaxConcurrent, "rpc-concurrency", c.RPCMaxConcurrent, "Most RPC calls in flight at once, 0 for no limit")
+	fs.StringVar(&c.FanRPCMode, "fan-rpc-mode", c.FanRPCMode, "Spread fans across --fan-rpc-urls: pinned or round-robin")
+	fs.StringVar(&c.FundingKeystore, "funding-keystore", c.FundingKeystore, "Encrypted JSON keystore file to fund fans from")
+	fs.StringVar(&c.FundingPasswordFile, "funding-password-file", c.FundingPasswordFile, "File holding the keystore's password")
+	fs.StringVar(&c.FundingSignerURL, "funding-signer", c.FundingSignerURL, "URL of a Clef compatible external signer to fund fans through")
+	fs.StringVar(&c.FundingAccount, "funding-account", c.FundingAccount, "Address the external signer funds fans from")
+	fs.StringVar(&c.LogLevel, "log-level", c.LogLevel, "Log level: trace, debug, info, warn, or error")
+	fs.StringVar(&c.ListenAddress, "listen", c.ListenAddress, "Address to serve the dashboard and API on")
+	fs.IntVar(&c.FanCount, "fans", c.FanCount, "How many fans to start with")
+	fs.Float64Var(&c.FundAmountEther, "fund-amount", c.FundAmountEther, "How much ETH to fund each fan with")
+	fs.Float64Var(&c.RefundThresholdEther, "refund-threshold", c.RefundThresholdEther, "Lowest ETH balance a fan can have before it's topped up")
+	fs.StringVar(&c.FanKeysFile, "fan-keys", c.FanKeysFile, "File to save and load fan keys from")
+	fs.Float64Var(&c.PeakGasPriceGwei, "peak-gas-price", c.PeakGasPriceGwei, "Peak target gas price in gwei")
+	fs.Float64Var(&c.FloorGasPriceGwei, "floor-gas-price", c.FloorGasPriceGwei, "Floor target gas price in gwei")
+	fs.StringVar(&c.TxRateModel, "rate-model", c.TxRateModel, "Transaction rate model: uniform, fixed, poisson, or fill")
+	fs.Float64Var(&c.TxRate, "rate", c.TxRate, "Transaction rate, meaning depends on the rate model")
+	fs.StringVar(&c.SendMode, "send-mode", c.SendMode, "When fans send transactions: block or timer")
+	fs.StringVar(&c.BlockHistoryFile, "block-history", c.BlockHistoryFile, "File to persist block history to")
+	fs.StringVar(&c.ExportDir, "export-dir", c.ExportDir, "Where to write exports of the run")
+	fs.BoolVar(&c.AllowPublicChain, "allow-public-chain", c.AllowPublicChain, "Run against known public chains and well funded funders anyway")
+	fs.Float64Var(&c.MaxFundingBalanceEther, "max-funding-balance", c.MaxFundingBalanceEther, "Refuse to start if the funder holds more ETH than this, unless --allow-public-chain is set")
+	fs.Float64Var(&c.SpendCapEther, "spend-cap", c.SpendCapEther, "Stop funding fans once this much ETH has been sent to them, 0 for no cap")
+	fs.Float64Var(&c.BudgetEther, "budget", c.BudgetEther, "Pause fans once they've burned this much ETH on gas and sends, 0 for no budget")
+	fs.BoolVar(&c.ExportOnShutdown, "export", c.ExportOnShutdown, "Write an export of the run when shutting down")
+}
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+var (
+	// Decrypting a keystore is slow on purpose, so keep keys around in case the config is refreshed
+	keystoreMu   sync.Mutex
+	keystoreKeys = map[string]*ecdsa.PrivateKey{}
+
+	signerMu     sync.Mutex
+	signerClient *rpc.Client
+	signerURL    string
+)
+
+// loadFunder works out the funding address, and the funding private key unless using an external signer
+func (c *Config) loadFunder() error {
+	switch {
+	case c.FundingSignerURL != "":
+		c.FundingPrivateKey = nil
+		c.FundingAddress = common.HexToAddress(c.FundingAccount)
+		return nil
+	case c.FundingKeystore != "":
+		key, err := readKeystore(c.FundingKeystore, c.FundingPasswordFile)
+		if err != nil {
+			return err
+		}
+		c.FundingPrivateKey = key
+	default:
+		key, err := crypto.HexToECDSA(c.FundingKey)
+		if err != nil {
+			return err
+		}
+		c.FundingPrivateKey = key
+	}
+	c.FundingAddress = crypto.PubkeyToAddress(c.FundingPrivateKey.PublicKey)
+	return nil
+}
+
+// readKeystore decrypts an encrypted JSON keystore file with the password in passwordFile
+func readKeystore(path, passwordFile string) (*ecdsa.PrivateKey, error) {
+	keystoreMu.Lock()
+	defer keystoreMu.Unlock()
+	cacheKey := path + "\x00" + passwordFile
+	if key, ok := keystoreKeys[cacheKey]; ok {
+		return key, nil
+	}
+
+	keyJSON, err := os.ReadFile(path) // #nosec G304 - path is operator supplied
+	if err != nil {
+		return nil, fmt.Errorf("error reading FUNDING_KEYSTORE: %w", err)
+	}
+	password, err := os.ReadFile(passwordFile) // #nosec G304 - path is operator supplied
+	if err != nil {
+		return nil, fmt.Errorf("error reading FUNDING_PASSWORD_FILE: %w", err)
+	}
+	key, err := keystore.DecryptKey(keyJSON, strings.TrimRight(string(password), "\r\n"))
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting FUNDING_KEYSTORE %s: %w", path, err)
+	}
+	keystoreKeys[cacheKey] = key.PrivateKey
+	return key.PrivateKey, nil
+}
+
+// signTransactionResult is what a Clef compatible signer responds to account_signTransaction with
+type signTransactionResult struct {
+	Raw hexutil.Bytes      `json:"raw"`
+	Tx  *types.Transaction `json:"tx"`
+}
+
+// SignFundingTx signs a transaction from the funding address, either with the funding key or by the external signer
+func (c *Config) SignFundingTx(ctx context.Context, tx *types.Transaction) (*types.Transaction, error) {
+	if c.FundingSignerURL == "" {
+		return types.SignTx(tx, types.LatestSignerForChainID(c.BigChainID), c.FundingPrivateKey)
+	}
+
+	client, err := externalSigner(ctx, c.FundingSignerURL)
+	if err != nil {
+		return nil, err
+	}
+	data := hexutil.Bytes(tx.Data())
+	args := &apitypes.SendTxArgs{
+		From:                 common.NewMixedcaseAddress(c.FundingAddress),
+		Gas:                  hexutil.Uint64(tx.Gas()),
+		MaxFeePerGas:         (*hexutil.Big)(tx.GasFeeCap()),
+		MaxPriorityFeePerGas: (*hexutil.Big)(tx.GasTipCap()),
+		Value:                hexutil.Big(*tx.Value()),
+		Nonce:                hexutil.Uint64(tx.Nonce()),
+		Data:                 &data,
+		ChainID:              (*hexutil.Big)(c.BigChainID),
+	}
+	if tx.To() != nil {
+		to := common.NewMixedcaseAddress(*tx.To())
+		args.To = &to
+	}
+	result := &signTransactionResult{}
+	if err = client.CallContext(ctx, result, "account_signTransaction", args); err != nil {
+		return nil, fmt.Errorf("external signer didn't sign transaction: %w", err)
+	}
+	if result.Tx == nil {
+		return nil, fmt.Errorf("external signer at %s returned no transaction", c.FundingSignerURL)
+	}
+	sender, err := types.Sender(types.LatestSignerForChainID(c.BigChainID), result.Tx)
+	if err != nil {
+		return nil, fmt.Errorf("external signer returned a badly signed transaction: %w", err)
+	}
+	if sender != c.FundingAddress {
+		return nil, fmt.Errorf("external signer signed as %s instead of %s", sender.Hex(), c.FundingAddress.Hex())
+	}
+	if err = signedAsAsked(tx, result.Tx); err != nil {
+		return nil, fmt.Errorf("external signer at %s changed the transaction: %w", c.FundingSignerURL, err)
+	}
+	return result.Tx, nil
+}
+
+// signedAsAsked checks that a signed transaction is the one that was asked for, so a misbehaving signer can't
+// redirect funds or spend more than it was asked to
+func signedAsAsked(asked, signed *types.Transaction) error {
+	problems := []error{}
+	differs := func(field string, want, got any) {
+		problems = append(problems, fmt.Errorf("%s is %v, asked for %v", field, got, want))
+	}
+	if (asked.To() == nil) != (signed.To() == nil) || (asked.To() != nil && *asked.To() != *signed.To()) {
+		differs("to", asked.To(), signed.To())
+	}
+	if asked.Value().Cmp(signed.Value()) != 0 {
+		differs("value", asked.Value(), signed.Value())
+	}
+	if asked.Nonce() != signed.Nonce() {
+		differs("nonce", asked.Nonce(), signed.Nonce())
+	}
+	if asked.Gas() != signed.Gas() {
+		differs("gas", asked.Gas(), signed.Gas())
+	}
+	if asked.GasFeeCap().Cmp(signed.GasFeeCap()) != 0 {
+		differs("fee cap", asked.GasFeeCap(), signed.GasFeeCap())
+	}
+	if asked.GasTipCap().Cmp(signed.GasTipCap()) != 0 {
+		differs("tip cap", asked.GasTipCap(), signed.GasTipCap())
+	}
+	if asked.ChainId().Cmp(signed.ChainId()) != 0 {
+		differs("chain ID", asked.ChainId(), signed.ChainId())
+	}
+	if !bytes.Equal(asked.Data(), signed.Data()) {
+		differs("data", hexutil.Bytes(asked.Data()), hexutil.Bytes(signed.Data()))
+	}
+	return errors.Join(problems...)
+}
+
+// externalSigner connects to the external signer, reusing the connection while the URL stays the same
+func externalSigner(ctx context.Context, url string) (*rpc.Client, error) {
+	signerMu.Lock()
+	defer signerMu.Unlock()
+	if signerClient != nil && signerURL == url {
+		return signerClient, nil
+	}
+	if signerClient != nil {
+		signerClient.Close()
+	}
+	client, err := rpc.DialContext(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to external signer at %s: %w", url, err)
+	}
+	signerClient, signerURL = client, url
+	return client, nil
+}
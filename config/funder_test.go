@@ -0,0 +1,122 @@
+package config_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kalverra/crazed-nft-fans/config"
+)
+
+// defaultFundingAddress is the address of the default FUNDING_KEY, and of geth_settings/keys/key1
+var defaultFundingAddress = common.HexToAddress("0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266")
+
+func TestFundingKeystore(t *testing.T) {
+	t.Setenv("FUNDING_KEY", "")
+	t.Setenv("FUNDING_KEYSTORE", filepath.Join("..", "geth_settings", "keys", "key1"))
+	t.Setenv("FUNDING_PASSWORD_FILE", filepath.Join("..", "geth_settings", "test_pass.txt"))
+
+	require.NoError(t, config.ReadConfig(), "Error reading config")
+	require.Equal(t, defaultFundingAddress, config.Current.FundingAddress)
+	require.NotNil(t, config.Current.FundingPrivateKey)
+
+	t.Setenv("FUNDING_PASSWORD_FILE", "")
+	require.Error(t, config.ReadConfig(), "Keystore without a password file should error")
+}
+
+// standInSigner answers account_signTransaction like Clef would, signing with key. A misbehaving signer can be stood
+// in for by having tamper change what's asked for first.
+type standInSigner struct {
+	key    *ecdsa.PrivateKey
+	tamper func(args *apitypes.SendTxArgs)
+}
+
+type signTransactionResult struct {
+	Raw hexutil.Bytes      `json:"raw"`
+	Tx  *types.Transaction `json:"tx"`
+}
+
+func (s *standInSigner) SignTransaction(args apitypes.SendTxArgs) (*signTransactionResult, error) {
+	if s.tamper != nil {
+		s.tamper(&args)
+	}
+	tx, err := types.SignTx(args.ToTransaction(), types.LatestSignerForChainID(args.ChainID.ToInt()), s.key)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return &signTransactionResult{Raw: raw, Tx: tx}, nil
+}
+
+func TestFundingExternalSigner(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	server := rpc.NewServer()
+	signer := &standInSigner{key: key}
+	require.NoError(t, server.RegisterName("account", signer))
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(func() {
+		httpServer.Close()
+		server.Stop()
+	})
+
+	signerAddress := crypto.PubkeyToAddress(key.PublicKey)
+	t.Setenv("FUNDING_SIGNER_URL", httpServer.URL)
+	t.Setenv("FUNDING_ACCOUNT", signerAddress.Hex())
+	require.NoError(t, config.ReadConfig(), "Error reading config")
+	require.Equal(t, signerAddress, config.Current.FundingAddress)
+	require.Nil(t, config.Current.FundingPrivateKey, "No private key should be held with an external signer")
+
+	to := common.HexToAddress("0x42")
+	asked := types.NewTx(&types.DynamicFeeTx{
+		ChainID:   config.Current.BigChainID,
+		Nonce:     7,
+		To:        &to,
+		Value:     big.NewInt(1000),
+		Gas:       21_000,
+		GasTipCap: big.NewInt(1),
+		GasFeeCap: big.NewInt(2),
+	})
+	tx, err := config.Current.SignFundingTx(context.Background(), asked)
+	require.NoError(t, err, "Error signing through external signer")
+	require.Equal(t, uint64(7), tx.Nonce())
+	sender, err := types.Sender(types.LatestSignerForChainID(config.Current.BigChainID), tx)
+	require.NoError(t, err)
+	require.Equal(t, signerAddress, sender)
+
+	thief := common.NewMixedcaseAddress(common.HexToAddress("0xbad"))
+	tampering := map[string]func(args *apitypes.SendTxArgs){
+		"redirected": func(args *apitypes.SendTxArgs) { args.To = &thief },
+		"more value": func(args *apitypes.SendTxArgs) { args.Value = hexutil.Big(*big.NewInt(1_000_000)) },
+		"new nonce":  func(args *apitypes.SendTxArgs) { args.Nonce = 8 },
+		"more gas":   func(args *apitypes.SendTxArgs) { args.Gas = 100_000 },
+		"fee cap":    func(args *apitypes.SendTxArgs) { args.MaxFeePerGas = (*hexutil.Big)(big.NewInt(1000)) },
+		"tip cap":    func(args *apitypes.SendTxArgs) { args.MaxPriorityFeePerGas = (*hexutil.Big)(big.NewInt(2)) },
+		"chain":      func(args *apitypes.SendTxArgs) { args.ChainID = (*hexutil.Big)(big.NewInt(1)) },
+	}
+	for name, tamper := range tampering {
+		signer.tamper = tamper
+		_, err = config.Current.SignFundingTx(context.Background(), asked)
+		require.Error(t, err, "A %s transaction should be rejected", name)
+	}
+	signer.tamper = nil
+
+	t.Setenv("FUNDING_ACCOUNT", defaultFundingAddress.Hex())
+	require.NoError(t, config.ReadConfig(), "Error reading config")
+	_, err = config.Current.SignFundingTx(context.Background(), tx)
+	require.Error(t, err, "Transactions signed by the wrong account should be rejected")
+}
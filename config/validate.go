@@ -0,0 +1,108 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/rs/zerolog"
+)
+
+// Validate checks that the config makes sense, reporting every problem it finds at once
+func (c *Config) Validate() error {
+	errs := []error{}
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(hasScheme(c.HTTP, "http", "https"), "HTTP_URL must be an http:// or https:// URL, got '%s'", c.HTTP)
+	check(hasScheme(c.WS, "ws", "wss"), "WS_URL must be a ws:// or wss:// URL, got '%s'", c.WS)
+	check(c.ChainID > 0, "CHAIN_ID must be set")
+	for _, rpcURL := range c.FanRPCURLs {
+		check(hasScheme(rpcURL, "http", "https", "ws", "wss"), "FAN_RPC_URLS must be http(s):// or ws(s):// URLs, got '%s'", rpcURL)
+	}
+	check(c.RPCRateLimit >= 0, "RPC_RATE_LIMIT can't be negative, got %f", c.RPCRateLimit)
+	check(c.RPCRateLimit == 0 || c.RPCBurst > 0, "RPC_BURST must be greater than 0 to rate limit, got %d", c.RPCBurst)
+	check(c.RPCMaxConcurrent >= 0, "RPC_MAX_CONCURRENT can't be negative, got %d", c.RPCMaxConcurrent)
+	check(oneOf(c.FanRPCMode, "pinned", "round-robin"), "FAN_RPC_MODE must be pinned or round-robin, got '%s'", c.FanRPCMode)
+	switch {
+	case c.FundingSignerURL != "" && c.FundingKeystore != "":
+		errs = append(errs, errors.New("FUNDING_SIGNER_URL and FUNDING_KEYSTORE can't both be set"))
+	case c.FundingSignerURL != "":
+		check(common.IsHexAddress(c.FundingAccount),
+			"FUNDING_ACCOUNT must be the address to sign for with FUNDING_SIGNER_URL, got '%s'", c.FundingAccount)
+	case c.FundingKeystore != "":
+		check(c.FundingPasswordFile != "", "FUNDING_PASSWORD_FILE is needed to unlock FUNDING_KEYSTORE")
+	default:
+		if _, err := crypto.HexToECDSA(c.FundingKey); err != nil {
+			errs = append(errs, fmt.Errorf("FUNDING_KEY is not a valid private key: %w", err))
+		}
+	}
+	if _, err := zerolog.ParseLevel(c.LogLevel); err != nil {
+		errs = append(errs, fmt.Errorf("LOG_LEVEL: %w", err))
+	}
+
+	check(c.FloorGasPriceGwei > 0, "FLOOR_GAS_PRICE must be greater than 0, got %f", c.FloorGasPriceGwei)
+	check(c.FloorGasPriceGwei <= c.PeakGasPriceGwei,
+		"FLOOR_GAS_PRICE (%f) can't be above PEAK_GAS_PRICE (%f)", c.FloorGasPriceGwei, c.PeakGasPriceGwei)
+	check(c.FanCount >= 0, "FAN_COUNT can't be negative, got %d", c.FanCount)
+	check(c.FundAmountEther > 0, "FUND_AMOUNT must be greater than 0, got %f", c.FundAmountEther)
+	check(c.RefundThresholdEther >= 0 && c.RefundThresholdEther < c.FundAmountEther,
+		"REFUND_THRESHOLD must be at least 0 and below FUND_AMOUNT (%f), got %f", c.FundAmountEther, c.RefundThresholdEther)
+	check(c.RefundLeadBlocks >= 0, "REFUND_LEAD_BLOCKS can't be negative, got %d", c.RefundLeadBlocks)
+	check(c.RefundTopUpBlocks > 0, "REFUND_TOPUP_BLOCKS must be greater than 0, got %d", c.RefundTopUpBlocks)
+	check(c.MaxFundingBalanceEther > 0, "MAX_FUNDING_BALANCE must be greater than 0, got %f", c.MaxFundingBalanceEther)
+	check(c.SpendCapEther >= 0, "SPEND_CAP can't be negative, got %f", c.SpendCapEther)
+	check(c.BudgetEther >= 0, "BUDGET can't be negative, got %f", c.BudgetEther)
+
+	check(oneOf(c.TxRateModel, "uniform", "fixed", "poisson", "fill"),
+		"TX_RATE_MODEL must be one of uniform, fixed, poisson, or fill, got '%s'", c.TxRateModel)
+	check(c.TxRate >= 0, "TX_RATE can't be negative, got %f", c.TxRate)
+	check(oneOf(c.SendMode, "block", "timer"), "SEND_MODE must be block or timer, got '%s'", c.SendMode)
+	check(c.ExpectedBlockTime > 0, "EXPECTED_BLOCK_TIME must be greater than 0, got %s", c.ExpectedBlockTime)
+
+	check(c.SpikeMultiplier > 0, "SPIKE_MULTIPLIER must be greater than 0, got %f", c.SpikeMultiplier)
+	check(c.SpikeDuration >= 0, "SPIKE_DURATION can't be negative, got %s", c.SpikeDuration)
+	check(oneOf(c.SpikeDecay, "instant", "linear", "exponential"),
+		"SPIKE_DECAY must be one of instant, linear, or exponential, got '%s'", c.SpikeDecay)
+
+	check(c.BlockHistorySize > 0, "BLOCK_HISTORY_SIZE must be greater than 0, got %d", c.BlockHistorySize)
+	check(c.TxHistorySize > 0, "TX_HISTORY_SIZE must be greater than 0, got %d", c.TxHistorySize)
+	check(c.MempoolPollInterval >= 0, "MEMPOOL_POLL_INTERVAL can't be negative, got %s", c.MempoolPollInterval)
+	errs = append(errs, checkPercentiles("FEE_HISTORY_PERCENTILES", c.FeeHistoryPercentiles)...)
+	errs = append(errs, checkPercentiles("MEMPOOL_TIP_PERCENTILES", c.MempoolTipPercentiles)...)
+	return errors.Join(errs...)
+}
+
+// checkPercentiles makes sure the percentiles for setting are between 0 and 100, in ascending order
+func checkPercentiles(setting string, percentiles []float64) []error {
+	errs := []error{}
+	for i, percentile := range percentiles {
+		if percentile < 0 || percentile > 100 {
+			errs = append(errs, fmt.Errorf("%s percentile %f is outside of 0-100", setting, percentile))
+		}
+		if i > 0 && percentile <= percentiles[i-1] {
+			errs = append(errs, fmt.Errorf("%s must be in ascending order, got %v", setting, percentiles))
+			break
+		}
+	}
+	return errs
+}
+
+func hasScheme(rawURL string, schemes ...string) bool {
+	parsed, err := url.Parse(rawURL)
+	return err == nil && parsed.Host != "" && oneOf(parsed.Scheme, schemes...)
+}
+
+func oneOf(value string, options ...string) bool {
+	for _, option := range options {
+		if value == option {
+			return true
+		}
+	}
+	return false
+}
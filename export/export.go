@@ -0,0 +1,193 @@
+// Package export writes out the results of a run for analysis, in the same shape as the historical data in the
+// analysis folder so simulated runs can be compared against real congestion events
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/kalverra/crazed-nft-fans/convert"
+	"github.com/kalverra/crazed-nft-fans/fans"
+	"github.com/kalverra/crazed-nft-fans/president"
+)
+
+// fileTimeFormat is how times show up in export file names
+const fileTimeFormat = "2006-01-02T15-04-05"
+
+// FanTransaction is a transaction along with the fan that it belongs to
+type FanTransaction struct {
+	Fan string `json:"fan"`
+	fans.TransactionRecord
+}
+
+// blockHeader matches the columns of analysis/crypto_kitties_*.csv, followed by everything else we track
+var blockHeader = []string{
+	"block_number", "average_gwei_paid",
+	"timestamp", "base_fee_gwei", "target_gwei", "suggested_gwei",
+	"min_priority_fee_gwei", "median_priority_fee_gwei", "max_priority_fee_gwei",
+	"gas_used", "gas_limit", "percent_filled", "tx_count", "fan_tx_count", "other_tx_count",
+}
+
+var transactionHeader = []string{
+	"fan", "hash", "kind", "nonce", "to", "value_wei",
+	"gas_tip_cap_gwei", "gas_fee_cap_gwei", "base_fee_gwei",
+	"status", "error", "sent", "block_number", "latency_ms", "endpoint",
+}
+
+// Result lists the files an export wrote, and how many transactions were left out of it
+type Result struct {
+	Files []string `json:"files"`
+	// ForgottenTransactions is how many transactions fans had already forgotten, beyond the last TX_HISTORY_SIZE
+	// each of them remembers, and so couldn't be exported
+	ForgottenTransactions int `json:"forgottenTransactions"`
+}
+
+// Run writes the blocks tracked this run, and the transactions remembered by every fan that's been in the club this
+// run, dismissed ones included, to CSV and JSON files in dir. Each fan only remembers its last TX_HISTORY_SIZE
+// transactions, so how many older ones were left out is reported along with the files written.
+func Run(dir string) (*Result, error) {
+	blocks, err := president.RunBlocks()
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{}
+	transactions := []FanTransaction{}
+	for _, fan := range president.AllFans() {
+		for _, record := range fan.Transactions() {
+			transactions = append(transactions, FanTransaction{Fan: fan.Address.Hex(), TransactionRecord: record})
+		}
+		result.ForgottenTransactions += fan.Forgotten()
+	}
+	result.Files, err = Write(dir, blocks, transactions)
+	return result, err
+}
+
+// Write writes blocks and transactions to CSV and JSON files in dir, named after the time span the blocks cover
+func Write(dir string, blocks []*president.TrackedBlock, transactions []FanTransaction) ([]string, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+	prefix := filepath.Join(dir, "crazed_nft_fans_"+timeSpan(blocks))
+
+	writers := []struct {
+		path  string
+		write func(io.Writer) error
+	}{
+		{prefix + "_blocks.csv", func(w io.Writer) error { return BlocksCSV(w, blocks) }},
+		{prefix + "_blocks.json", func(w io.Writer) error { return writeJSON(w, blocks) }},
+		{prefix + "_transactions.csv", func(w io.Writer) error { return TransactionsCSV(w, transactions) }},
+		{prefix + "_transactions.json", func(w io.Writer) error { return writeJSON(w, transactions) }},
+	}
+	paths := make([]string, 0, len(writers))
+	for _, writer := range writers {
+		if err := writeFile(writer.path, writer.write); err != nil {
+			return paths, err
+		}
+		paths = append(paths, writer.path)
+	}
+	return paths, nil
+}
+
+// BlocksCSV writes blocks as CSV, starting with the same columns as the historical data
+func BlocksCSV(w io.Writer, blocks []*president.TrackedBlock) error {
+	csvWriter := csv.NewWriter(w)
+	if err := csvWriter.Write(blockHeader); err != nil {
+		return err
+	}
+	for _, block := range blocks {
+		err := csvWriter.Write([]string{
+			strconv.FormatUint(block.Number, 10),
+			gwei(block.AvgGasPricePaid),
+			strconv.FormatUint(block.Timestamp, 10),
+			gwei(block.BaseFee),
+			gwei(block.TargetGasPrice),
+			gwei(block.GasPrice),
+			gwei(block.MinPriorityFee),
+			gwei(block.MedianPriorityFee),
+			gwei(block.MaxPriorityFee),
+			strconv.FormatUint(block.GasUsed, 10),
+			strconv.FormatUint(block.GasLimit, 10),
+			strconv.FormatFloat(block.PercentFilled, 'f', -1, 64),
+			strconv.Itoa(block.TxCount),
+			strconv.Itoa(block.FanTxCount),
+			strconv.Itoa(block.OtherTxCount),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// TransactionsCSV writes fan transactions as CSV
+func TransactionsCSV(w io.Writer, transactions []FanTransaction) error {
+	csvWriter := csv.NewWriter(w)
+	if err := csvWriter.Write(transactionHeader); err != nil {
+		return err
+	}
+	for _, tx := range transactions {
+		err := csvWriter.Write([]string{
+			tx.Fan,
+			tx.Hash,
+			string(tx.Kind),
+			strconv.FormatUint(tx.Nonce, 10),
+			tx.To,
+			tx.Value,
+			gwei(tx.GasTipCap),
+			gwei(tx.GasFeeCap),
+			gwei(tx.BaseFee),
+			string(tx.Status),
+			tx.Error,
+			tx.Sent.UTC().Format(time.RFC3339Nano),
+			strconv.FormatUint(tx.BlockNumber, 10),
+			strconv.FormatInt(tx.LatencyMs, 10),
+			tx.Endpoint,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// timeSpan names the stretch of time the blocks cover, or now if there aren't any
+func timeSpan(blocks []*president.TrackedBlock) string {
+	if len(blocks) == 0 {
+		return time.Now().UTC().Format(fileTimeFormat)
+	}
+	start := time.Unix(int64(blocks[0].Timestamp), 0).UTC()
+	end := time.Unix(int64(blocks[len(blocks)-1].Timestamp), 0).UTC()
+	return fmt.Sprintf("%s-to-%s", start.Format(fileTimeFormat), end.Format(fileTimeFormat))
+}
+
+func gwei(wei uint64) string {
+	gweiFloat, _ := convert.WeiToGwei(new(big.Int).SetUint64(wei)).Float64()
+	return strconv.FormatFloat(gweiFloat, 'f', -1, 64)
+}
+
+func writeJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func writeFile(path string, write func(io.Writer) error) error {
+	file, err := os.Create(path) // #nosec G304 - path is built from operator supplied config
+	if err != nil {
+		return err
+	}
+	if err = write(file); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,59 @@
+package export_test
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kalverra/crazed-nft-fans/export"
+	"github.com/kalverra/crazed-nft-fans/fans"
+	"github.com/kalverra/crazed-nft-fans/president"
+)
+
+func TestWrite(t *testing.T) {
+	dir := t.TempDir()
+	blocks := []*president.TrackedBlock{
+		{Number: 100, Timestamp: 1512604800, AvgGasPricePaid: 26_500_000_000, TxCount: 3, FanTxCount: 2, OtherTxCount: 1},
+		{Number: 101, Timestamp: 1512604815, AvgGasPricePaid: 79_300_000_000},
+	}
+	transactions := []export.FanTransaction{{
+		Fan: "0x42",
+		TransactionRecord: fans.TransactionRecord{
+			Hash:      "0xabc",
+			Kind:      fans.KindRandom,
+			GasTipCap: 2_000_000_000,
+			Status:    fans.StatusConfirmed,
+			Sent:      time.Unix(1512604801, 0),
+			LatencyMs: 1500,
+		},
+	}}
+
+	paths, err := export.Write(dir, blocks, transactions)
+	require.NoError(t, err, "Error exporting")
+	require.Len(t, paths, 4)
+	for _, path := range paths {
+		require.FileExists(t, path)
+		require.Contains(t, filepath.Base(path), "2017-12-07T00-00-00-to-2017-12-07T00-00-15")
+	}
+
+	blocksFile, err := os.Open(paths[0])
+	require.NoError(t, err, "Error opening blocks CSV")
+	defer blocksFile.Close()
+	rows, err := csv.NewReader(blocksFile).ReadAll()
+	require.NoError(t, err, "Error reading blocks CSV")
+	require.Len(t, rows, 3)
+	require.Equal(t, []string{"block_number", "average_gwei_paid"}, rows[0][:2], "Should match the historical data's columns")
+	require.Equal(t, []string{"100", "26.5"}, rows[1][:2])
+	require.Equal(t, []string{"101", "79.3"}, rows[2][:2])
+
+	transactionsCSV, err := os.ReadFile(paths[2])
+	require.NoError(t, err, "Error reading transactions CSV")
+	lines := strings.Split(strings.TrimSpace(string(transactionsCSV)), "\n")
+	require.Len(t, lines, 2)
+	require.True(t, strings.HasPrefix(lines[1], "0x42,0xabc,random,"), lines[1])
+}
@@ -0,0 +1,154 @@
+package fans
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// EndpointMode is how fans spread their transactions across RPC endpoints
+type EndpointMode string
+
+// Endpoint modes
+const (
+	EndpointsPinned     EndpointMode = "pinned"      // Each fan sends everything through one endpoint, assigned in turn
+	EndpointsRoundRobin EndpointMode = "round-robin" // Fans take turns across every endpoint with each transaction
+)
+
+// Endpoint is an RPC endpoint fans send transactions through
+type Endpoint struct {
+	URL    string
+	client *ethclient.Client
+
+	statsMu      sync.Mutex
+	fans         int
+	sent         int
+	failed       int
+	confirmed    int
+	totalLatency time.Duration
+}
+
+// EndpointStats describes how the transactions sent through an endpoint have fared
+type EndpointStats struct {
+	URL          string `json:"url"`
+	Fans         int    `json:"fans"` // Fans pinned to the endpoint
+	Sent         int    `json:"sent"`
+	Failed       int    `json:"failed"`
+	Confirmed    int    `json:"confirmed"`
+	AvgLatencyMs int64  `json:"avgLatencyMs"`
+}
+
+// EndpointPool hands out the endpoints fans send transactions through
+type EndpointPool struct {
+	Mode      EndpointMode
+	endpoints []*Endpoint
+	next      atomic.Uint64
+}
+
+// DialEndpoints connects to every URL, for fans to spread their transactions across according to mode
+func DialEndpoints(ctx context.Context, urls []string, mode EndpointMode) (*EndpointPool, error) {
+	if mode != EndpointsPinned && mode != EndpointsRoundRobin {
+		return nil, fmt.Errorf("unknown endpoint mode '%s', use %s or %s", mode, EndpointsPinned, EndpointsRoundRobin)
+	}
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no endpoints to dial")
+	}
+	pool := &EndpointPool{Mode: mode}
+	for _, url := range urls {
+		client, err := ethclient.DialContext(ctx, url)
+		if err != nil {
+			pool.Close()
+			return nil, fmt.Errorf("error dialing endpoint %s: %w", url, err)
+		}
+		pool.endpoints = append(pool.endpoints, &Endpoint{URL: url, client: client})
+	}
+	return pool, nil
+}
+
+// Close disconnects from every endpoint
+func (p *EndpointPool) Close() {
+	for _, endpoint := range p.endpoints {
+		endpoint.client.Close()
+	}
+}
+
+// Stats returns how each endpoint's transactions have fared
+func (p *EndpointPool) Stats() []EndpointStats {
+	stats := make([]EndpointStats, 0, len(p.endpoints))
+	for _, endpoint := range p.endpoints {
+		stats = append(stats, endpoint.Stats())
+	}
+	return stats
+}
+
+// take returns the next endpoint in turn
+func (p *EndpointPool) take() *Endpoint {
+	return p.endpoints[(p.next.Add(1)-1)%uint64(len(p.endpoints))]
+}
+
+// Stats returns how the endpoint's transactions have fared
+func (e *Endpoint) Stats() EndpointStats {
+	e.statsMu.Lock()
+	defer e.statsMu.Unlock()
+	stats := EndpointStats{URL: e.URL, Fans: e.fans, Sent: e.sent, Failed: e.failed, Confirmed: e.confirmed}
+	if e.confirmed > 0 {
+		stats.AvgLatencyMs = e.totalLatency.Milliseconds() / int64(e.confirmed)
+	}
+	return stats
+}
+
+func (e *Endpoint) recordSend(err error) {
+	e.statsMu.Lock()
+	defer e.statsMu.Unlock()
+	if err != nil {
+		e.failed++
+	} else {
+		e.sent++
+	}
+}
+
+func (e *Endpoint) recordConfirm(latency time.Duration) {
+	e.statsMu.Lock()
+	defer e.statsMu.Unlock()
+	e.confirmed++
+	e.totalLatency += latency
+}
+
+// UseEndpoints has the fan send its transactions through the pool's endpoints rather than the client it was created
+// with. Pinned fans are assigned the next endpoint in turn.
+func (f *Fan) UseEndpoints(pool *EndpointPool) {
+	f.trackedMu.Lock()
+	defer f.trackedMu.Unlock()
+	f.endpoints, f.pinned = pool, nil
+	if pool.Mode == EndpointsPinned {
+		f.pinned = pool.take()
+		f.pinned.statsMu.Lock()
+		f.pinned.fans++
+		f.pinned.statsMu.Unlock()
+	}
+}
+
+// clientFor returns the client to reach endpoint with, the fan's own if it's nil
+func (f *Fan) clientFor(endpoint *Endpoint) *ethclient.Client {
+	if endpoint != nil {
+		return endpoint.client
+	}
+	return f.client
+}
+
+// sendEndpoint picks the endpoint for the fan's next transaction, nil meaning the client it was created with. The
+// caller must hold the fan's tracking lock.
+func (f *Fan) sendEndpoint() *Endpoint {
+	switch {
+	case f.pinned != nil:
+		return f.pinned
+	case f.endpoints != nil:
+		return f.endpoints.take()
+	default:
+		return nil
+	}
+}
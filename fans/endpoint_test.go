@@ -0,0 +1,60 @@
+package fans_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kalverra/crazed-nft-fans/fans"
+)
+
+func TestPinnedEndpoints(t *testing.T) {
+	urls := []string{"http://node-a:8545", "http://node-b:8545", "http://node-c:8545"}
+	pool, err := fans.DialEndpoints(context.Background(), urls, fans.EndpointsPinned)
+	require.NoError(t, err, "Error dialing endpoints")
+	t.Cleanup(pool.Close)
+
+	for i := 0; i < 4; i++ {
+		(&fans.Fan{}).UseEndpoints(pool)
+	}
+	stats := pool.Stats()
+	require.Len(t, stats, len(urls))
+	for i, want := range []int{2, 1, 1} {
+		require.Equal(t, urls[i], stats[i].URL)
+		require.Equal(t, want, stats[i].Fans, "Fans should be pinned to endpoints in turn")
+	}
+}
+
+func TestSendEndpoints(t *testing.T) {
+	urls := []string{"http://node-a:8545", "http://node-b:8545", "http://node-c:8545"}
+	roundRobin, err := fans.DialEndpoints(context.Background(), urls, fans.EndpointsRoundRobin)
+	require.NoError(t, err, "Error dialing endpoints")
+	t.Cleanup(roundRobin.Close)
+	pinned, err := fans.DialEndpoints(context.Background(), urls, fans.EndpointsPinned)
+	require.NoError(t, err, "Error dialing endpoints")
+	t.Cleanup(pinned.Close)
+
+	rotating, sticking := &fans.Fan{}, &fans.Fan{}
+	rotating.UseEndpoints(roundRobin)
+	sticking.UseEndpoints(pinned)
+	for i := 0; i < 2*len(urls); i++ {
+		require.Equal(t, urls[i%len(urls)], rotating.SendEndpoint().URL, "Round robin fans should take each endpoint in turn")
+		require.Equal(t, urls[0], sticking.SendEndpoint().URL, "Pinned fans should stick to their endpoint")
+	}
+	require.Nil(t, (&fans.Fan{}).SendEndpoint(), "Fans without endpoints should use their own client")
+}
+
+func TestRoundRobinEndpoints(t *testing.T) {
+	pool, err := fans.DialEndpoints(context.Background(), []string{"http://node-a:8545"}, fans.EndpointsRoundRobin)
+	require.NoError(t, err, "Error dialing endpoints")
+	t.Cleanup(pool.Close)
+
+	(&fans.Fan{}).UseEndpoints(pool)
+	require.Zero(t, pool.Stats()[0].Fans, "Round robin fans shouldn't be pinned anywhere")
+
+	_, err = fans.DialEndpoints(context.Background(), []string{"http://node-a:8545"}, "random")
+	require.Error(t, err, "Unknown modes should be refused")
+	_, err = fans.DialEndpoints(context.Background(), nil, fans.EndpointsPinned)
+	require.Error(t, err, "There should be at least one endpoint")
+}
@@ -0,0 +1,82 @@
+package fans
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Errors fans return, wrapping whatever caused them. Use errors.Is to check for them.
+var (
+	// ErrInsufficientBalance means there isn't enough ETH to pay for a transaction, either by the fan's own count or
+	// according to the node
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	// ErrNonceTooLow means a transaction's nonce has already been used
+	ErrNonceTooLow = errors.New("nonce too low")
+	// ErrReplacementUnderpriced means a transaction with the same nonce is already pending, and this one doesn't pay
+	// enough more to replace it
+	ErrReplacementUnderpriced = errors.New("replacement transaction underpriced")
+	// ErrFeeCapTooLow means a transaction's fee cap is below the base fee
+	ErrFeeCapTooLow = errors.New("fee cap below base fee")
+	// ErrTxPoolFull means the node's transaction pool has no room left
+	ErrTxPoolFull = errors.New("transaction pool full")
+	// ErrTimeout means the node, or a transaction confirming, took too long
+	ErrTimeout = errors.New("timed out")
+)
+
+// gethErrors maps the messages geth's JSON-RPC errors carry to the fans' errors
+var gethErrors = []struct {
+	message string
+	err     error
+}{
+	{"insufficient funds", ErrInsufficientBalance},
+	{"nonce too low", ErrNonceTooLow},
+	{"replacement transaction underpriced", ErrReplacementUnderpriced},
+	{"max fee per gas less than block base fee", ErrFeeCapTooLow},
+	{"fee cap less than block base fee", ErrFeeCapTooLow}, // How geth worded it before 1.10.9
+	{"txpool is full", ErrTxPoolFull},
+}
+
+// TransactionError is an error sending or confirming one of a fan's transactions
+type TransactionError struct {
+	Fan  common.Address
+	Hash common.Hash
+	Kind TransactionKind
+	Err  error
+}
+
+func (e *TransactionError) Error() string {
+	return fmt.Sprintf("%s transaction %s for fan %s: %v", e.Kind, e.Hash.Hex(), e.Fan.Hex(), e.Err)
+}
+
+func (e *TransactionError) Unwrap() error {
+	return e.Err
+}
+
+// Classify wraps an error from the node in the fans' error it matches, so errors.Is works on it. Errors that don't
+// match any are returned as they are.
+func Classify(err error) error {
+	if err == nil {
+		return nil
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	message := strings.ToLower(err.Error())
+	for _, gethErr := range gethErrors {
+		if strings.Contains(message, gethErr.message) {
+			return fmt.Errorf("%w: %w", gethErr.err, err)
+		}
+	}
+	return err
+}
+
+// transactionError classifies an error with one of the fan's transactions, and says which transaction it was
+func (f *Fan) transactionError(hash common.Hash, kind TransactionKind, err error) error {
+	return &TransactionError{Fan: *f.Address, Hash: hash, Kind: kind, Err: Classify(err)}
+}
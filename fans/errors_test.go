@@ -0,0 +1,57 @@
+package fans_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kalverra/crazed-nft-fans/fans"
+)
+
+func TestClassify(t *testing.T) {
+	// Over JSON-RPC, geth's errors only arrive as their messages
+	tests := []struct {
+		name    string
+		message string
+		want    error
+	}{
+		{"insufficient funds", "insufficient funds for gas * price + value", fans.ErrInsufficientBalance},
+		{"nonce too low", "nonce too low", fans.ErrNonceTooLow},
+		{"replacement underpriced", "replacement transaction underpriced", fans.ErrReplacementUnderpriced},
+		{"fee cap too low", "max fee per gas less than block base fee", fans.ErrFeeCapTooLow},
+		{"pool full", "txpool is full", fans.ErrTxPoolFull},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			fromNode := errors.New(test.message)
+			classified := fans.Classify(fromNode)
+			require.ErrorIs(t, classified, test.want)
+			require.ErrorIs(t, classified, fromNode, "Classifying should keep the original error")
+		})
+	}
+
+	require.ErrorIs(t, fans.Classify(fmt.Errorf("sending: %w", context.DeadlineExceeded)), fans.ErrTimeout)
+	unknown := errors.New("something else went wrong")
+	require.Equal(t, unknown, fans.Classify(unknown), "Unknown errors should pass through untouched")
+	require.NoError(t, fans.Classify(nil))
+}
+
+func TestTransactionError(t *testing.T) {
+	var err error = &fans.TransactionError{
+		Fan:  common.HexToAddress("0x42"),
+		Kind: fans.KindRandom,
+		Err:  fans.Classify(errors.New("nonce too low")),
+	}
+	err = fmt.Errorf("sending: %w", err)
+
+	require.ErrorIs(t, err, fans.ErrNonceTooLow)
+	txErr := &fans.TransactionError{}
+	require.ErrorAs(t, err, &txErr)
+	require.Equal(t, common.HexToAddress("0x42"), txErr.Fan)
+	require.Equal(t, fans.KindRandom, txErr.Kind)
+}
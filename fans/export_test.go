@@ -0,0 +1,15 @@
+package fans
+
+// SendEndpoint lets tests see which endpoint the fan's next transaction would go through
+func (f *Fan) SendEndpoint() *Endpoint {
+	f.trackedMu.Lock()
+	defer f.trackedMu.Unlock()
+	return f.sendEndpoint()
+}
+
+// Remember adds a record to the fan's history as if it had sent the transaction
+func (f *Fan) Remember(record TransactionRecord) {
+	f.trackedMu.Lock()
+	defer f.trackedMu.Unlock()
+	f.remember(&record)
+}
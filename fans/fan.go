@@ -4,12 +4,13 @@ import (
 	"context"
 	"crypto/ecdsa"
 	bigrand "crypto/rand"
+	"errors"
 	"fmt"
 	"math/big"
-	"math/rand"
 	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -18,15 +19,30 @@ import (
 
 	"github.com/kalverra/crazed-nft-fans/config"
 	"github.com/kalverra/crazed-nft-fans/convert"
+	"github.com/kalverra/crazed-nft-fans/throttle"
 )
 
 type trackedTransaction struct {
 	tx       *types.Transaction
 	timeSent time.Time
+	record   *TransactionRecord
+	endpoint *Endpoint // Where the transaction was sent, nil for the fan's own client
 }
 
 var sendAmount = big.NewInt(42069)
 
+// rpcLimiter throttles every fan's RPC calls together, nil for no limit
+var rpcLimiter *throttle.Limiter
+
+// SetRPCLimiter has every fan make its RPC calls through limiter, so they load the node together without overwhelming
+// it. Set it before fans start sending.
+func SetRPCLimiter(limiter *throttle.Limiter) {
+	rpcLimiter = limiter
+}
+
+// spendWindow is how many recent blocks a fan's spend rate is averaged over
+const spendWindow = 10
+
 // Fan is an NFT fan that will search for NFTs
 type Fan struct {
 	Address        *common.Address
@@ -34,24 +50,42 @@ type Fan struct {
 	TargetGasPrice *big.Int
 
 	funded              bool
+	retired             bool
 	balance             *big.Int
 	pendingNonce        uint64
 	trackedTransactions map[common.Hash]trackedTransaction
+	transactions        []*TransactionRecord
+	forgotten           int // transactions dropped from transactions to stay within TX_HISTORY_SIZE
+	sentCount           int
+	confirmedCount      int
+	failedCount         int
+	totalLatency        time.Duration
+	blockSpend          *big.Int   // wei committed to transactions sent since the last block
+	recentSpend         []*big.Int // wei committed in each of the last spendWindow blocks
 	trackedMu           sync.RWMutex
 	client              *ethclient.Client
+	endpoints           *EndpointPool // Endpoints to send transactions through instead of client, if any
+	pinned              *Endpoint     // The endpoint the fan sends everything through, if it's pinned to one
 }
 
 // New creates a new fan
-func New(client *ethclient.Client) (*Fan, error) {
+func New(ctx context.Context, client *ethclient.Client) (*Fan, error) {
 	key, err := crypto.GenerateKey()
 	if err != nil {
 		return nil, err
 	}
+	return NewFromKey(ctx, client, key)
+}
+
+// NewFromKey brings back a fan from its private key, e.g. one saved from a previous run
+func NewFromKey(ctx context.Context, client *ethclient.Client, key *ecdsa.PrivateKey) (*Fan, error) {
 	addr, err := convert.PrivateKeyToAddress(key)
 	if err != nil {
 		return nil, err
 	}
-	nonce, err := client.PendingNonceAt(context.Background(), *addr)
+	nonce, err := throttle.Call(ctx, rpcLimiter, func(ctx context.Context) (uint64, error) {
+		return client.PendingNonceAt(ctx, *addr)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -63,36 +97,93 @@ func New(client *ethclient.Client) (*Fan, error) {
 
 		funded:              false,
 		balance:             big.NewInt(0),
+		blockSpend:          big.NewInt(0),
 		pendingNonce:        nonce,
 		trackedTransactions: map[common.Hash]trackedTransaction{},
 		client:              client,
 	}, nil
 }
 
-// ReceiveBlock receives a new block from the chain, and updates pending transactions accordingly
-func (f *Fan) ReceiveBlock(newBlock *types.Block, targetGasPrice *big.Int) error {
+// errNotSending is returned when a fan that's out of funds or retired is asked to send
+var errNotSending = errors.New("fan isn't sending")
+
+// ReceiveBlock receives a new block from the chain, updates pending transactions accordingly, then sends txCount
+// new transactions. Transactions still waiting on the RPC limits when stale is done, usually because the next block
+// has arrived, are dropped rather than sent late.
+func (f *Fan) ReceiveBlock(
+	ctx, stale context.Context,
+	newBlock *types.Block,
+	targetGasPrice *big.Int,
+	txCount int,
+) error {
+	f.trackedMu.Lock()
 	f.TargetGasPrice = targetGasPrice
+	f.confirmTransactions(newBlock)
+	f.trackedMu.Unlock()
+
+	for i := 0; i < txCount; i++ {
+		_, err := f.SendRandomTransaction(ctx, stale, newBlock.BaseFee())
+		switch {
+		case errors.Is(err, errNotSending), errors.Is(err, throttle.ErrShed):
+			return nil
+		case err != nil:
+			return err
+		}
+	}
+	return nil
+}
+
+// ConfirmBlock updates pending transactions from a new block, without sending anything new
+func (f *Fan) ConfirmBlock(newBlock *types.Block) {
 	f.trackedMu.Lock()
 	defer f.trackedMu.Unlock()
+	f.confirmTransactions(newBlock)
+}
+
+// confirmTransactions stops tracking any of our transactions that made it into the block. The caller must hold the
+// fan's tracking lock.
+func (f *Fan) confirmTransactions(newBlock *types.Block) {
+	seen := time.Now()
 	for _, tx := range newBlock.Transactions() {
 		if _, ok := f.trackedTransactions[tx.Hash()]; ok {
-			delete(f.trackedTransactions, tx.Hash())
+			f.confirm(tx.Hash(), newBlock.NumberU64(), seen)
 			log.Trace().Str("Hash", tx.Hash().Hex()).Msg("Confirmed transaction")
 		}
 	}
-	if f.funded {
-		for i := 0; i < rand.Intn(20); i++ {
-			_, err := f.SendRandomTransaction(newBlock.BaseFee())
-			if err != nil {
-				return err
-			}
-		}
+	f.recentSpend = append(f.recentSpend, f.blockSpend)
+	if len(f.recentSpend) > spendWindow {
+		f.recentSpend = f.recentSpend[len(f.recentSpend)-spendWindow:]
 	}
+	f.blockSpend = big.NewInt(0)
+}
 
-	return nil
+// SendRandomTransaction sends a small amount of funds to a random address once the RPC limits allow it, unless stale is
+// done first. The fan is only locked once the send is allowed, so it can still be looked at while it waits.
+func (f *Fan) SendRandomTransaction(ctx, stale context.Context, baseFee *big.Int) (common.Hash, error) {
+	var (
+		hash     common.Hash
+		endpoint *Endpoint
+	)
+	err := rpcLimiter.DoUnlessStale(ctx, stale, func(ctx context.Context) error {
+		f.trackedMu.Lock()
+		defer f.trackedMu.Unlock()
+		if !f.funded || f.retired {
+			return errNotSending
+		}
+		var err error
+		endpoint = f.sendEndpoint()
+		hash, err = f.sendRandomTransaction(ctx, baseFee, endpoint)
+		return err
+	})
+	if err != nil && !errors.Is(err, errNotSending) && !errors.Is(err, throttle.ErrShed) {
+		f.recoverFromSendError(ctx, err, endpoint)
+	}
+	return hash, err
 }
 
-func (f *Fan) SendRandomTransaction(baseFee *big.Int) (common.Hash, error) {
+// sendRandomTransaction signs and sends a random transaction through endpoint, or the fan's own client if it's nil.
+// The caller must hold the fan's tracking lock, and have cleared the send with the RPC limiter.
+func (f *Fan) sendRandomTransaction(ctx context.Context, baseFee *big.Int, endpoint *Endpoint) (common.Hash, error) {
 	key, err := crypto.GenerateKey()
 	if err != nil {
 		log.Error().Err(err).Msg("Error generating key")
@@ -108,13 +199,13 @@ func (f *Fan) SendRandomTransaction(baseFee *big.Int) (common.Hash, error) {
 		log.Error().Err(err).Msg("Error calculating gas")
 		return common.Hash{}, err
 	}
-	totalGasCost := big.NewInt(0).Mul(gasFeeCap, big.NewInt(21_000))
-	if totalGasCost.Cmp(f.balance) >= 0 {
+	// The most the transaction could cost, so the fan's balance errs low
+	cost := big.NewInt(0).Mul(gasFeeCap, big.NewInt(21_000))
+	cost.Add(cost, sendAmount)
+	if cost.Cmp(f.balance) > 0 {
 		f.funded = false
-		return common.Hash{}, fmt.Errorf("not enough balance to send transaction")
+		return common.Hash{}, fmt.Errorf("%w: fan %s has %s wei, transaction needs %s", ErrInsufficientBalance, f.Address.Hex(), f.balance, cost)
 	}
-	f.balance.Sub(f.balance, gasFeeCap)
-	f.balance.Sub(f.balance, sendAmount)
 	tx, err := types.SignNewTx(f.PrivateKey, types.LatestSignerForChainID(config.Current.BigChainID), &types.DynamicFeeTx{
 		ChainID:   config.Current.BigChainID,
 		Nonce:     f.pendingNonce,
@@ -128,15 +219,19 @@ func (f *Fan) SendRandomTransaction(baseFee *big.Int) (common.Hash, error) {
 		log.Error().Err(err).Msg("Error signing transaction")
 		return common.Hash{}, err
 	}
-	f.pendingNonce++
-	err = f.client.SendTransaction(context.Background(), tx)
+	err = f.clientFor(endpoint).SendTransaction(ctx, tx)
+	if endpoint != nil {
+		endpoint.recordSend(err)
+	}
 	if err != nil {
+		err = f.transactionError(tx.Hash(), KindRandom, err)
+		f.trackFailure(tx, KindRandom, baseFee, endpoint, err)
 		return common.Hash{}, err
 	}
-	f.trackedTransactions[tx.Hash()] = trackedTransaction{
-		tx:       tx,
-		timeSent: time.Now(),
-	}
+	f.pendingNonce++
+	f.balance.Sub(f.balance, cost)
+	f.blockSpend.Add(f.blockSpend, cost)
+	f.track(tx, KindRandom, baseFee, endpoint)
 	log.Trace().
 		Str("Hash", tx.Hash().Hex()).
 		Uint64("Gas Tip Cap", gasTipCap.Uint64()).
@@ -145,6 +240,33 @@ func (f *Fan) SendRandomTransaction(baseFee *big.Int) (common.Hash, error) {
 	return tx.Hash(), nil
 }
 
+// recoverFromSendError gets the fan back into a state it can send from after the node at endpoint refuses a
+// transaction. Nonces are synced with that node, as others might not have seen everything it has yet.
+func (f *Fan) recoverFromSendError(ctx context.Context, err error, endpoint *Endpoint) {
+	switch {
+	case errors.Is(err, ErrInsufficientBalance):
+		f.trackedMu.Lock()
+		f.funded = false
+		f.trackedMu.Unlock()
+	case errors.Is(err, ErrNonceTooLow), errors.Is(err, ErrReplacementUnderpriced), errors.Is(err, ErrTimeout):
+		// The nonce has been used, or might have been, so ask the node where the fan is up to
+		nonce, nonceErr := throttle.Call(ctx, rpcLimiter, func(ctx context.Context) (uint64, error) {
+			return f.clientFor(endpoint).PendingNonceAt(ctx, *f.Address)
+		})
+		if nonceErr != nil {
+			log.Warn().Err(nonceErr).Str("Fan", f.Address.Hex()).Msg("Error syncing fan's nonce")
+			return
+		}
+		f.trackedMu.Lock()
+		defer f.trackedMu.Unlock()
+		log.Debug().Str("Fan", f.Address.Hex()).Uint64("Was", f.pendingNonce).Uint64("Now", nonce).Msg("Synced fan's nonce")
+		f.pendingNonce = nonce
+	}
+}
+
+// TipStrategy describes how fans pick their gas tips
+const TipStrategy = "uniformly random from 0.5x up to 2.5x the target gas price"
+
 // gasTipCap = floorPrice + floor(Flutter * random, peak)
 func (f *Fan) calculateGas(baseFee *big.Int) (gasTipCap, gasFeeCap *big.Int, err error) {
 	lowerBound, upperBound := big.NewInt(0).Quo(f.TargetGasPrice, big.NewInt(2)), big.NewInt(0).Mul(f.TargetGasPrice, big.NewInt(2))
@@ -158,62 +280,129 @@ func (f *Fan) calculateGas(baseFee *big.Int) (gasTipCap, gasFeeCap *big.Int, err
 	return gasTipCap, gasFeeCap, nil
 }
 
-func (f *Fan) Fund(wei *big.Int, fundingNonce uint64, timeout time.Duration) error {
-	latestHeader, err := f.client.HeaderByNumber(context.Background(), nil)
+// Fund sends the fan wei from the funding key with the next of nonces, and waits for the transaction to confirm. Each
+// timeout it goes without confirming, the node is asked whether it still has it. Funding the node has dropped is given
+// up on with ErrTimeout, but funding it still has is waited on for as long as it takes, so the fan isn't funded twice.
+func (f *Fan) Fund(ctx context.Context, wei *big.Int, nonces *Nonces, timeout time.Duration) error {
+	latestHeader, err := throttle.Call(ctx, rpcLimiter, func(ctx context.Context) (*types.Header, error) {
+		return f.client.HeaderByNumber(ctx, nil)
+	})
 	if err != nil {
-		return err
+		return Classify(err)
 	}
 	baseFee := new(big.Int).Mul(latestHeader.BaseFee, big.NewInt(2))
-	tipCap, err := f.client.SuggestGasTipCap(context.Background())
+	tipCap, err := throttle.Call(ctx, rpcLimiter, f.client.SuggestGasTipCap)
 	if err != nil {
-		return err
+		return Classify(err)
 	}
 	gasFeeCap := big.NewInt(0).Add(baseFee, tipCap)
-	tx, err := types.SignNewTx(config.Current.FundingPrivateKey, types.LatestSignerForChainID(config.Current.BigChainID), &types.DynamicFeeTx{
-		ChainID:   config.Current.BigChainID,
-		Nonce:     fundingNonce,
-		To:        f.Address,
-		Value:     wei,
-		Gas:       21_000,
-		GasTipCap: tipCap,
-		GasFeeCap: gasFeeCap,
+
+	var tx *types.Transaction
+	err = nonces.Send(ctx, func(nonce uint64) error {
+		signed, err := config.Current.SignFundingTx(ctx, types.NewTx(&types.DynamicFeeTx{
+			ChainID:   config.Current.BigChainID,
+			Nonce:     nonce,
+			To:        f.Address,
+			Value:     wei,
+			Gas:       21_000,
+			GasTipCap: tipCap,
+			GasFeeCap: gasFeeCap,
+		}))
+		if err != nil {
+			return err
+		}
+		err = rpcLimiter.Do(ctx, func(ctx context.Context) error {
+			return f.client.SendTransaction(ctx, signed)
+		})
+		f.trackedMu.Lock()
+		defer f.trackedMu.Unlock()
+		if err != nil {
+			err = f.transactionError(signed.Hash(), KindFund, err)
+			f.trackFailure(signed, KindFund, latestHeader.BaseFee, nil, err)
+			return err
+		}
+		log.Trace().Str("Hash", signed.Hash().Hex()).Uint64("Nonce", nonce).Str("Wei", wei.String()).Msg("Funding fan")
+		f.track(signed, KindFund, latestHeader.BaseFee, nil)
+		tx = signed
+		return nil
 	})
 	if err != nil {
 		return err
 	}
 
-	err = f.client.SendTransaction(context.Background(), tx)
-	if err != nil {
-		return err
-	}
-	log.Trace().Str("Hash", tx.Hash().Hex()).Uint64("Nonce", fundingNonce).Uint64("Wei", wei.Uint64()).Msg("Funding fan")
-	f.trackedTransactions[tx.Hash()] = trackedTransaction{
-		tx:       tx,
-		timeSent: time.Now(),
-	}
-	err = f.ConfirmTransaction(tx.Hash(), timeout)
-	if err != nil {
-		return err
+	for confirmed := false; !confirmed; {
+		err = f.ConfirmTransaction(ctx, tx.Hash(), timeout)
+		if !errors.Is(err, ErrTimeout) {
+			if err != nil {
+				return err
+			}
+			break
+		}
+		if confirmed, err = f.checkOnFunding(ctx, tx.Hash()); err != nil {
+			if syncErr := nonces.Sync(ctx); syncErr != nil {
+				log.Warn().Err(syncErr).Msg("Error syncing funding nonce")
+			}
+			return err
+		}
 	}
+	f.trackedMu.Lock()
+	defer f.trackedMu.Unlock()
 	f.balance.Add(f.balance, wei)
 	f.funded = true
 	return nil
 }
 
-func (f *Fan) ConfirmTransaction(txHash common.Hash, timeout time.Duration) error {
+// checkOnFunding asks the node what's become of a funding transaction that's taking a while to confirm. Funding that's
+// made it into a block is confirmed, and funding the node no longer has is dropped and returned as an error.
+func (f *Fan) checkOnFunding(ctx context.Context, hash common.Hash) (confirmed bool, err error) {
+	receipt, err := throttle.Call(ctx, rpcLimiter, func(ctx context.Context) (*types.Receipt, error) {
+		return f.client.TransactionReceipt(ctx, hash)
+	})
+	if err == nil {
+		f.trackedMu.Lock()
+		defer f.trackedMu.Unlock()
+		f.confirm(hash, receipt.BlockNumber.Uint64(), time.Now())
+		return true, nil
+	}
+	err = rpcLimiter.Do(ctx, func(ctx context.Context) error {
+		_, _, err := f.client.TransactionByHash(ctx, hash)
+		return err
+	})
+	switch {
+	case errors.Is(err, ethereum.NotFound):
+		err = &TransactionError{Fan: *f.Address, Hash: hash, Kind: KindFund,
+			Err: fmt.Errorf("%w: dropped by the node before confirming", ErrTimeout)}
+		f.trackedMu.Lock()
+		defer f.trackedMu.Unlock()
+		f.drop(hash, err)
+		return false, err
+	case err != nil:
+		log.Warn().Err(err).Str("Hash", hash.Hex()).Msg("Error checking on funding, still waiting for it")
+	default:
+		log.Debug().Str("Hash", hash.Hex()).Str("Fan", f.Address.Hex()).Msg("Funding still pending")
+	}
+	return false, nil
+}
+
+// ConfirmTransaction waits for a tracked transaction to show up in a block
+func (f *Fan) ConfirmTransaction(ctx context.Context, txHash common.Hash, timeout time.Duration) error {
 	f.trackedMu.RLock()
-	if _, ok := f.trackedTransactions[txHash]; !ok {
+	_, ok := f.trackedTransactions[txHash]
+	f.trackedMu.RUnlock()
+	if !ok {
 		return fmt.Errorf("transaction %s not found", txHash.Hex())
 	}
-	f.trackedMu.RUnlock()
 
 	timeoutC := time.After(timeout)
 	check := time.NewTicker(500 * time.Millisecond)
 	defer check.Stop()
 	for {
 		select {
+		case <-ctx.Done():
+			return ctx.Err()
 		case <-timeoutC:
-			return fmt.Errorf("error confirming tx %s after %s", txHash.Hex(), timeout)
+			return &TransactionError{Fan: *f.Address, Hash: txHash, Kind: f.transactionKind(txHash),
+				Err: fmt.Errorf("%w: not confirmed after %s", ErrTimeout, timeout)}
 		case <-check.C:
 			f.trackedMu.RLock()
 			_, ok := f.trackedTransactions[txHash]
@@ -225,3 +414,55 @@ func (f *Fan) ConfirmTransaction(txHash common.Hash, timeout time.Duration) erro
 		}
 	}
 }
+
+// transactionKind looks up why a transaction the fan is tracking was sent
+func (f *Fan) transactionKind(txHash common.Hash) TransactionKind {
+	f.trackedMu.RLock()
+	defer f.trackedMu.RUnlock()
+	if tracked, ok := f.trackedTransactions[txHash]; ok {
+		return tracked.record.Kind
+	}
+	return ""
+}
+
+// Funded returns whether the fan currently has enough funds to send transactions
+func (f *Fan) Funded() bool {
+	f.trackedMu.RLock()
+	defer f.trackedMu.RUnlock()
+	return f.funded
+}
+
+// Balance returns the fan's estimated balance in wei, from what it's been funded and the most its transactions
+// could have cost
+func (f *Fan) Balance() *big.Int {
+	f.trackedMu.RLock()
+	defer f.trackedMu.RUnlock()
+	return new(big.Int).Set(f.balance)
+}
+
+// SpendRate returns how much wei per block the fan has been committing to transactions, averaged over its recent
+// blocks. It's 0 until the fan has seen a block.
+func (f *Fan) SpendRate() *big.Int {
+	f.trackedMu.RLock()
+	defer f.trackedMu.RUnlock()
+	return f.spendRate()
+}
+
+// spendRate averages the fan's recent spending. The caller must hold the fan's tracking lock.
+func (f *Fan) spendRate() *big.Int {
+	total := big.NewInt(0)
+	if len(f.recentSpend) == 0 {
+		return total
+	}
+	for _, spend := range f.recentSpend {
+		total.Add(total, spend)
+	}
+	return total.Div(total, big.NewInt(int64(len(f.recentSpend))))
+}
+
+// PendingTransactions returns how many transactions the fan has sent that haven't been confirmed yet
+func (f *Fan) PendingTransactions() int {
+	f.trackedMu.RLock()
+	defer f.trackedMu.RUnlock()
+	return len(f.trackedTransactions)
+}
@@ -0,0 +1,50 @@
+package fans_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kalverra/crazed-nft-fans/config"
+	"github.com/kalverra/crazed-nft-fans/fans"
+	"github.com/kalverra/crazed-nft-fans/throttle"
+)
+
+func TestReceiveBlockSheds(t *testing.T) {
+	limiter := throttle.New(1, 1, 0)
+	require.NoError(t, limiter.Do(context.Background(), func(ctx context.Context) error { return nil }),
+		"Using up the burst leaves the next call waiting a second")
+	fans.SetRPCLimiter(limiter)
+	t.Cleanup(func() { fans.SetRPCLimiter(nil) })
+
+	stale, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1), BaseFee: big.NewInt(100)})
+	start := time.Now()
+	require.NoError(t, (&fans.Fan{}).ReceiveBlock(context.Background(), stale, block, big.NewInt(1), 5),
+		"Dropped transactions aren't an error")
+	require.Less(t, time.Since(start), 500*time.Millisecond, "The fan shouldn't keep waiting once the block is stale")
+
+	stats := limiter.Stats()
+	require.Equal(t, uint64(1), stats.Shed, "The rest of the block's transactions should be dropped")
+	require.Equal(t, uint64(1), stats.Calls, "Nothing should be sent for a stale block")
+}
+
+func TestForgottenTransactions(t *testing.T) {
+	previous := config.Current
+	config.Current = &config.Config{TxHistorySize: 3}
+	t.Cleanup(func() { config.Current = previous })
+
+	fan := &fans.Fan{}
+	for nonce := uint64(0); nonce < 5; nonce++ {
+		fan.Remember(fans.TransactionRecord{Nonce: nonce})
+	}
+	records := fan.Transactions()
+	require.Len(t, records, 3)
+	require.Equal(t, uint64(2), records[0].Nonce, "The oldest transactions should be forgotten first")
+	require.Equal(t, 2, fan.Forgotten(), "Forgotten transactions should be counted")
+}
@@ -0,0 +1,200 @@
+package fans
+
+import (
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/kalverra/crazed-nft-fans/config"
+)
+
+// TransactionKind is why a fan's transaction was sent
+type TransactionKind string
+
+// Kinds of fan transactions
+const (
+	KindRandom TransactionKind = "random" // Crazed sends to random addresses
+	KindFund   TransactionKind = "fund"   // Funding from the funding key to the fan
+	KindSweep  TransactionKind = "sweep"  // Sweeping a dismissed fan's leftover funds back
+)
+
+// TransactionStatus is what's happened to a fan's transaction
+type TransactionStatus string
+
+// Transaction statuses
+const (
+	StatusPending   TransactionStatus = "pending"
+	StatusConfirmed TransactionStatus = "confirmed"
+	StatusFailed    TransactionStatus = "failed"
+)
+
+// TransactionRecord is a transaction a fan has sent, and what's happened to it since
+type TransactionRecord struct {
+	Hash        string            `json:"hash"`
+	Kind        TransactionKind   `json:"kind"`
+	Nonce       uint64            `json:"nonce"`
+	To          string            `json:"to"`
+	Value       string            `json:"value"`
+	GasTipCap   uint64            `json:"gasTipCap"`
+	GasFeeCap   uint64            `json:"gasFeeCap"`
+	BaseFee     uint64            `json:"baseFee"`            // Latest base fee known when the transaction was sent
+	Endpoint    string            `json:"endpoint,omitempty"` // RPC endpoint it was sent through, if not the default
+	Status      TransactionStatus `json:"status"`
+	Error       string            `json:"error,omitempty"`
+	Sent        time.Time         `json:"sent"`
+	BlockNumber uint64            `json:"blockNumber,omitempty"`
+	LatencyMs   int64             `json:"latencyMs,omitempty"` // Time from sending to seeing it in a block
+}
+
+// Info is a snapshot of what a fan is up to
+type Info struct {
+	Address      string `json:"address"`
+	Balance      string `json:"balance"`   // Estimated balance in wei, from what the fan's been funded and has spent
+	SpendRate    string `json:"spendRate"` // Wei per block the fan has recently been spending
+	Nonce        uint64 `json:"nonce"`
+	Funded       bool   `json:"funded"`
+	Retired      bool   `json:"retired"`
+	Sent         int    `json:"sent"`
+	Confirmed    int    `json:"confirmed"`
+	Failed       int    `json:"failed"`
+	Pending      int    `json:"pending"`
+	AvgLatencyMs int64  `json:"avgLatencyMs"`
+}
+
+// Info returns a snapshot of what the fan is up to
+func (f *Fan) Info() Info {
+	f.trackedMu.RLock()
+	defer f.trackedMu.RUnlock()
+
+	info := Info{
+		Address:   f.Address.Hex(),
+		Balance:   f.balance.String(),
+		Nonce:     f.pendingNonce,
+		Funded:    f.funded,
+		Retired:   f.retired,
+		Sent:      f.sentCount,
+		Confirmed: f.confirmedCount,
+		Failed:    f.failedCount,
+		Pending:   len(f.trackedTransactions),
+	}
+	info.SpendRate = f.spendRate().String()
+	if f.confirmedCount > 0 {
+		info.AvgLatencyMs = f.totalLatency.Milliseconds() / int64(f.confirmedCount)
+	}
+	return info
+}
+
+// Forgotten returns how many of the fan's transactions have been forgotten to keep its history to TX_HISTORY_SIZE
+func (f *Fan) Forgotten() int {
+	f.trackedMu.RLock()
+	defer f.trackedMu.RUnlock()
+	return f.forgotten
+}
+
+// Transactions returns the fan's most recent transactions, up to TX_HISTORY_SIZE of them, oldest first
+func (f *Fan) Transactions() []TransactionRecord {
+	f.trackedMu.RLock()
+	defer f.trackedMu.RUnlock()
+
+	records := make([]TransactionRecord, 0, len(f.transactions))
+	for _, record := range f.transactions {
+		records = append(records, *record)
+	}
+	return records
+}
+
+// track starts tracking a transaction that's been sent, through endpoint if it's not nil. The caller must hold the
+// fan's tracking lock.
+func (f *Fan) track(tx *types.Transaction, kind TransactionKind, baseFee *big.Int, endpoint *Endpoint) {
+	record := newRecord(tx, kind, baseFee, endpoint)
+	record.Status = StatusPending
+	f.trackedTransactions[tx.Hash()] = trackedTransaction{
+		tx:       tx,
+		timeSent: record.Sent,
+		record:   record,
+		endpoint: endpoint,
+	}
+	f.sentCount++
+	f.remember(record)
+}
+
+// trackFailure records a transaction that couldn't be sent. The caller must hold the fan's tracking lock.
+func (f *Fan) trackFailure(tx *types.Transaction, kind TransactionKind, baseFee *big.Int, endpoint *Endpoint, err error) {
+	// The record already says which transaction it was
+	var txErr *TransactionError
+	if errors.As(err, &txErr) {
+		err = txErr.Err
+	}
+	record := newRecord(tx, kind, baseFee, endpoint)
+	record.Status, record.Error = StatusFailed, err.Error()
+	f.failedCount++
+	f.remember(record)
+}
+
+// confirm marks a tracked transaction as having made it into a block. The caller must hold the fan's tracking lock.
+func (f *Fan) confirm(hash common.Hash, blockNumber uint64, seen time.Time) {
+	tracked, ok := f.trackedTransactions[hash]
+	if !ok {
+		return
+	}
+	delete(f.trackedTransactions, hash)
+	latency := seen.Sub(tracked.timeSent)
+	tracked.record.Status = StatusConfirmed
+	tracked.record.BlockNumber = blockNumber
+	tracked.record.LatencyMs = latency.Milliseconds()
+	f.confirmedCount++
+	f.totalLatency += latency
+	if tracked.endpoint != nil {
+		tracked.endpoint.recordConfirm(latency)
+	}
+}
+
+// drop stops tracking a transaction the node has lost, recording it as failed. The caller must hold the fan's tracking
+// lock.
+func (f *Fan) drop(hash common.Hash, err error) {
+	tracked, ok := f.trackedTransactions[hash]
+	if !ok {
+		return
+	}
+	delete(f.trackedTransactions, hash)
+	var txErr *TransactionError
+	if errors.As(err, &txErr) {
+		err = txErr.Err
+	}
+	tracked.record.Status, tracked.record.Error = StatusFailed, err.Error()
+	f.failedCount++
+}
+
+// remember adds a record to the fan's history, forgetting the oldest if it's full
+func (f *Fan) remember(record *TransactionRecord) {
+	f.transactions = append(f.transactions, record)
+	if limit := config.Current.TxHistorySize; limit > 0 && len(f.transactions) > limit {
+		f.forgotten += len(f.transactions) - limit
+		f.transactions = f.transactions[len(f.transactions)-limit:]
+	}
+}
+
+func newRecord(tx *types.Transaction, kind TransactionKind, baseFee *big.Int, endpoint *Endpoint) *TransactionRecord {
+	record := &TransactionRecord{
+		Hash:      tx.Hash().Hex(),
+		Kind:      kind,
+		Nonce:     tx.Nonce(),
+		Value:     tx.Value().String(),
+		GasTipCap: tx.GasTipCap().Uint64(),
+		GasFeeCap: tx.GasFeeCap().Uint64(),
+		Sent:      time.Now(),
+	}
+	if tx.To() != nil {
+		record.To = tx.To().Hex()
+	}
+	if baseFee != nil {
+		record.BaseFee = baseFee.Uint64()
+	}
+	if endpoint != nil {
+		record.Endpoint = endpoint.URL
+	}
+	return record
+}
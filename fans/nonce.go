@@ -0,0 +1,68 @@
+package fans
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/rs/zerolog/log"
+
+	"github.com/kalverra/crazed-nft-fans/throttle"
+)
+
+// Nonces hands out an address's nonces one transaction at a time, so a transaction that fails to send doesn't leave a
+// gap that every later transaction queues behind
+type Nonces struct {
+	Address common.Address
+
+	mu     sync.Mutex
+	next   uint64
+	client *ethclient.Client
+}
+
+// NewNonces starts handing out address's nonces from the node's pending nonce
+func NewNonces(ctx context.Context, client *ethclient.Client, address common.Address) (*Nonces, error) {
+	nonces := &Nonces{Address: address, client: client}
+	if err := nonces.sync(ctx); err != nil {
+		return nil, err
+	}
+	return nonces, nil
+}
+
+// Send calls send with the next nonce, and nobody else gets a nonce until it returns. The nonce is only used up if
+// send succeeds. If send might have used it anyway, like when it times out, the next nonce is asked of the node.
+func (n *Nonces) Send(ctx context.Context, send func(nonce uint64) error) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	err := send(n.next)
+	switch {
+	case err == nil:
+		n.next++
+	case errors.Is(err, ErrNonceTooLow), errors.Is(err, ErrReplacementUnderpriced), errors.Is(err, ErrTimeout):
+		if syncErr := n.sync(ctx); syncErr != nil {
+			log.Warn().Err(syncErr).Str("Address", n.Address.Hex()).Msg("Error syncing nonce")
+		}
+	}
+	return err
+}
+
+// Sync asks the node for the next nonce, for when a transaction sent with one of them has been dropped
+func (n *Nonces) Sync(ctx context.Context) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.sync(ctx)
+}
+
+// sync asks the node for the next nonce. The caller must hold the nonce lock.
+func (n *Nonces) sync(ctx context.Context) error {
+	nonce, err := throttle.Call(ctx, rpcLimiter, func(ctx context.Context) (uint64, error) {
+		return n.client.PendingNonceAt(ctx, n.Address)
+	})
+	if err != nil {
+		return Classify(err)
+	}
+	n.next = nonce
+	return nil
+}
@@ -0,0 +1,53 @@
+package fans_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kalverra/crazed-nft-fans/fans"
+)
+
+// nonceNode reports whatever pending nonce it's told to
+type nonceNode struct {
+	pending uint64
+}
+
+func (n *nonceNode) GetTransactionCount(common.Address, string) (hexutil.Uint64, error) {
+	return hexutil.Uint64(n.pending), nil
+}
+
+func TestNonces(t *testing.T) {
+	node := &nonceNode{pending: 7}
+	server := rpc.NewServer()
+	require.NoError(t, server.RegisterName("eth", node))
+	t.Cleanup(server.Stop)
+	ctx := context.Background()
+
+	nonces, err := fans.NewNonces(ctx, ethclient.NewClient(rpc.DialInProc(server)), common.HexToAddress("0x42"))
+	require.NoError(t, err)
+
+	used := []uint64{}
+	send := func(err error) func(nonce uint64) error {
+		return func(nonce uint64) error {
+			used = append(used, nonce)
+			return err
+		}
+	}
+	require.NoError(t, nonces.Send(ctx, send(nil)))
+	require.Error(t, nonces.Send(ctx, send(errors.New("signer said no"))))
+	require.NoError(t, nonces.Send(ctx, send(nil)))
+	require.Equal(t, []uint64{7, 8, 8}, used, "A transaction that didn't send shouldn't use up its nonce")
+
+	node.pending = 12
+	require.ErrorIs(t, nonces.Send(ctx, send(fmt.Errorf("%w: no answer", fans.ErrTimeout))), fans.ErrTimeout)
+	require.NoError(t, nonces.Send(ctx, send(nil)))
+	require.Equal(t, uint64(12), used[len(used)-1], "A timed out send should sync the nonce with the node")
+}
@@ -0,0 +1,127 @@
+package fans
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// gasPerTransaction is how much gas each of the fans' simple transfers uses
+const gasPerTransaction = 21_000
+
+// RateModelName names a way of deciding how many transactions a fan sends each block
+type RateModelName string
+
+// Available rate models
+const (
+	RateUniform RateModelName = "uniform" // Anywhere from 0 up to, not including, Rate transactions
+	RateFixed   RateModelName = "fixed"   // Exactly Rate transactions
+	RatePoisson RateModelName = "poisson" // Poisson distributed, averaging Rate transactions
+	RateFill    RateModelName = "fill"    // Enough transactions across the whole fan club to fill Rate percent of the block
+)
+
+// RateConfig describes how many transactions fans send for each block. What Rate means depends on the Model.
+type RateConfig struct {
+	Model RateModelName `json:"model"`
+	Rate  float64       `json:"rate"`
+}
+
+// RateModel decides how many transactions a fan sends for each block
+type RateModel interface {
+	// TransactionsPerBlock is how many transactions a single fan should send for a block with the given gas limit,
+	// when there are fanCount fans sending
+	TransactionsPerBlock(gasLimit uint64, fanCount int) int
+}
+
+// UniformRate sends anywhere from 0 up to, not including, Max transactions per block
+type UniformRate struct {
+	Max int
+}
+
+// FixedRate sends exactly Count transactions per block
+type FixedRate struct {
+	Count int
+}
+
+// PoissonRate sends a Poisson distributed number of transactions per block, averaging Mean
+type PoissonRate struct {
+	Mean float64
+}
+
+// FillRate has the fan club send enough transactions, between them, to fill PercentFilled of each block
+type FillRate struct {
+	PercentFilled float64
+}
+
+// NewRateModel builds the rate model described by the config
+func NewRateModel(rateConfig RateConfig) (RateModel, error) {
+	if rateConfig.Rate < 0 || math.IsNaN(rateConfig.Rate) || math.IsInf(rateConfig.Rate, 0) {
+		return nil, fmt.Errorf("transaction rate must be a non-negative number, got %f", rateConfig.Rate)
+	}
+	switch rateConfig.Model {
+	case RateUniform:
+		return &UniformRate{Max: int(rateConfig.Rate)}, nil
+	case RateFixed:
+		return &FixedRate{Count: int(rateConfig.Rate)}, nil
+	case RatePoisson:
+		return &PoissonRate{Mean: rateConfig.Rate}, nil
+	case RateFill:
+		if rateConfig.Rate > 100 {
+			return nil, fmt.Errorf("can't fill more than 100%% of a block, got %f", rateConfig.Rate)
+		}
+		return &FillRate{PercentFilled: rateConfig.Rate}, nil
+	default:
+		return nil, fmt.Errorf(
+			"unknown transaction rate model '%s', must be one of %s, %s, %s, %s",
+			rateConfig.Model, RateUniform, RateFixed, RatePoisson, RateFill,
+		)
+	}
+}
+
+// TransactionsPerBlock picks uniformly from 0 up to Max
+func (r *UniformRate) TransactionsPerBlock(uint64, int) int {
+	if r.Max <= 0 {
+		return 0
+	}
+	return rand.Intn(r.Max)
+}
+
+// TransactionsPerBlock is always Count
+func (r *FixedRate) TransactionsPerBlock(uint64, int) int {
+	return r.Count
+}
+
+// TransactionsPerBlock samples a Poisson distribution around Mean
+func (r *PoissonRate) TransactionsPerBlock(uint64, int) int {
+	return poisson(r.Mean)
+}
+
+// TransactionsPerBlock splits the transactions needed to fill the block evenly between fans, randomly rounding so
+// that the club hits the target on average
+func (r *FillRate) TransactionsPerBlock(gasLimit uint64, fanCount int) int {
+	if fanCount <= 0 {
+		return 0
+	}
+	perFan := r.PercentFilled / 100 * float64(gasLimit) / gasPerTransaction / float64(fanCount)
+	whole, fraction := math.Modf(perFan)
+	if rand.Float64() < fraction {
+		whole++
+	}
+	return int(whole)
+}
+
+// poisson samples a Poisson distribution with the given mean
+func poisson(mean float64) int {
+	if mean <= 0 {
+		return 0
+	}
+	if mean > 500 { // exp(-mean) underflows, but the normal approximation is very close by now
+		return int(math.Max(0, math.Round(rand.NormFloat64()*math.Sqrt(mean)+mean)))
+	}
+	limit, product, count := math.Exp(-mean), rand.Float64(), 0
+	for product > limit {
+		product *= rand.Float64()
+		count++
+	}
+	return count
+}
@@ -0,0 +1,52 @@
+package fans_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kalverra/crazed-nft-fans/fans"
+)
+
+func TestRateModels(t *testing.T) {
+	fixed, err := fans.NewRateModel(fans.RateConfig{Model: fans.RateFixed, Rate: 7})
+	require.NoError(t, err, "Error building fixed rate")
+	require.Equal(t, 7, fixed.TransactionsPerBlock(30_000_000, 10))
+
+	uniform, err := fans.NewRateModel(fans.RateConfig{Model: fans.RateUniform, Rate: 5})
+	require.NoError(t, err, "Error building uniform rate")
+	for i := 0; i < 100; i++ {
+		count := uniform.TransactionsPerBlock(30_000_000, 10)
+		require.GreaterOrEqual(t, count, 0)
+		require.Less(t, count, 5)
+	}
+}
+
+func TestRateModelAverages(t *testing.T) {
+	const samples = 10_000
+	average := func(model fans.RateModel, gasLimit uint64, fanCount int) float64 {
+		total := 0
+		for i := 0; i < samples; i++ {
+			total += model.TransactionsPerBlock(gasLimit, fanCount)
+		}
+		return float64(total) / samples
+	}
+
+	poisson, err := fans.NewRateModel(fans.RateConfig{Model: fans.RatePoisson, Rate: 4})
+	require.NoError(t, err, "Error building poisson rate")
+	require.InDelta(t, 4, average(poisson, 30_000_000, 10), 0.2)
+
+	// 50% of a 2.1M gas block is 50 transactions, split between 20 fans is 2.5 each
+	fill, err := fans.NewRateModel(fans.RateConfig{Model: fans.RateFill, Rate: 50})
+	require.NoError(t, err, "Error building fill rate")
+	require.InDelta(t, 2.5, average(fill, 2_100_000, 20), 0.1)
+}
+
+func TestBadRateModels(t *testing.T) {
+	_, err := fans.NewRateModel(fans.RateConfig{Model: "bursty", Rate: 1})
+	require.Error(t, err, "Unknown model should error")
+	_, err = fans.NewRateModel(fans.RateConfig{Model: fans.RateFixed, Rate: -1})
+	require.Error(t, err, "Negative rate should error")
+	_, err = fans.NewRateModel(fans.RateConfig{Model: fans.RateFill, Rate: 150})
+	require.Error(t, err, "Filling over 100% should error")
+}
@@ -0,0 +1,123 @@
+package fans
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/rs/zerolog/log"
+
+	"github.com/kalverra/crazed-nft-fans/config"
+	"github.com/kalverra/crazed-nft-fans/throttle"
+)
+
+// Retire stops the fan from sending any new transactions. It will still confirm the ones it has pending.
+func (f *Fan) Retire() {
+	f.trackedMu.Lock()
+	defer f.trackedMu.Unlock()
+	f.retired = true
+}
+
+// Retired returns whether the fan has been told to stop sending transactions
+func (f *Fan) Retired() bool {
+	f.trackedMu.RLock()
+	defer f.trackedMu.RUnlock()
+	return f.retired
+}
+
+// Drain waits for all of the fan's pending transactions to confirm
+func (f *Fan) Drain(ctx context.Context, timeout time.Duration) error {
+	timeoutC := time.After(timeout)
+	check := time.NewTicker(500 * time.Millisecond)
+	defer check.Stop()
+	for {
+		pending := f.PendingTransactions()
+		if pending == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeoutC:
+			return fmt.Errorf("%w: fan %s still has %d pending transactions after %s", ErrTimeout, f.Address.Hex(), pending, timeout)
+		case <-check.C:
+		}
+	}
+}
+
+// Sweep sends everything the fan has left, minus gas, to the given address and waits for it to confirm.
+// The fan should be retired and drained first.
+func (f *Fan) Sweep(ctx context.Context, to common.Address, timeout time.Duration) error {
+	balance, err := throttle.Call(ctx, rpcLimiter, func(ctx context.Context) (*big.Int, error) {
+		return f.client.BalanceAt(ctx, *f.Address, nil)
+	})
+	if err != nil {
+		return Classify(err)
+	}
+	latestHeader, err := throttle.Call(ctx, rpcLimiter, func(ctx context.Context) (*types.Header, error) {
+		return f.client.HeaderByNumber(ctx, nil)
+	})
+	if err != nil {
+		return Classify(err)
+	}
+	tipCap, err := throttle.Call(ctx, rpcLimiter, f.client.SuggestGasTipCap)
+	if err != nil {
+		return Classify(err)
+	}
+	gasFeeCap := new(big.Int).Mul(latestHeader.BaseFee, big.NewInt(2))
+	gasFeeCap.Add(gasFeeCap, tipCap)
+	value := new(big.Int).Sub(balance, new(big.Int).Mul(gasFeeCap, big.NewInt(21_000)))
+	if value.Sign() <= 0 {
+		log.Debug().Str("Fan", f.Address.Hex()).Str("Balance", balance.String()).Msg("Nothing worth sweeping")
+		f.emptied()
+		return nil
+	}
+	nonce, err := throttle.Call(ctx, rpcLimiter, func(ctx context.Context) (uint64, error) {
+		return f.client.PendingNonceAt(ctx, *f.Address)
+	})
+	if err != nil {
+		return Classify(err)
+	}
+
+	tx, err := types.SignNewTx(f.PrivateKey, types.LatestSignerForChainID(config.Current.BigChainID), &types.DynamicFeeTx{
+		ChainID:   config.Current.BigChainID,
+		Nonce:     nonce,
+		To:        &to,
+		Value:     value,
+		Gas:       21_000,
+		GasTipCap: tipCap,
+		GasFeeCap: gasFeeCap,
+	})
+	if err != nil {
+		return err
+	}
+	err = rpcLimiter.Do(ctx, func(ctx context.Context) error {
+		return f.client.SendTransaction(ctx, tx)
+	})
+	f.trackedMu.Lock()
+	if err != nil {
+		err = f.transactionError(tx.Hash(), KindSweep, err)
+		f.trackFailure(tx, KindSweep, latestHeader.BaseFee, nil, err)
+		f.trackedMu.Unlock()
+		return err
+	}
+	log.Trace().Str("Hash", tx.Hash().Hex()).Str("Fan", f.Address.Hex()).Str("Wei", value.String()).Msg("Sweeping fan")
+	f.track(tx, KindSweep, latestHeader.BaseFee, nil)
+	f.trackedMu.Unlock()
+	if err = f.ConfirmTransaction(ctx, tx.Hash(), timeout); err != nil {
+		return err
+	}
+	f.emptied()
+	return nil
+}
+
+// emptied marks the fan as having no funds left
+func (f *Fan) emptied() {
+	f.trackedMu.Lock()
+	defer f.trackedMu.Unlock()
+	f.balance = big.NewInt(0)
+	f.funded = false
+}
@@ -0,0 +1,61 @@
+package fans
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"math/rand"
+	"time"
+)
+
+// timerRecheck is the longest a fan sending on a timer waits before checking whether its sending rate has changed
+const timerRecheck = time.Second
+
+// SendConditions is what a fan sending on a timer needs to know about the market
+type SendConditions struct {
+	TxPerSecond    float64  // How many transactions per second the fan should average
+	BaseFee        *big.Int // Latest known base fee
+	TargetGasPrice *big.Int
+}
+
+// SendOnTimer sends transactions at random times rather than in a burst after each block, until ctx is done or the
+// fan is retired. Sends follow a Poisson process at the rate conditions gives, checked at least every second so
+// changes take effect quickly. Errors from sending are handed to onErr.
+func (f *Fan) SendOnTimer(ctx context.Context, conditions func() SendConditions, onErr func(error)) {
+	for {
+		if f.Retired() {
+			return
+		}
+		wait, send := timerRecheck, false
+		if current := conditions(); current.TxPerSecond > 0 && current.BaseFee != nil {
+			// Poisson processes are memoryless, so cutting a long wait short and re-rolling doesn't skew the rate
+			untilNext := time.Duration(rand.ExpFloat64() / current.TxPerSecond * float64(time.Second))
+			if untilNext < timerRecheck {
+				wait, send = untilNext, true
+			}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if !send {
+			continue
+		}
+
+		current := conditions()
+		if current.BaseFee == nil {
+			continue
+		}
+		f.trackedMu.Lock()
+		f.TargetGasPrice = current.TargetGasPrice
+		f.trackedMu.Unlock()
+		_, err := f.SendRandomTransaction(ctx, ctx, current.BaseFee)
+		if err != nil && !errors.Is(err, errNotSending) && ctx.Err() == nil {
+			onErr(err)
+		}
+	}
+}
@@ -1,16 +1,21 @@
 package main
 
 import (
-	"math/big"
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	_ "github.com/joho/godotenv/autoload"
 	"github.com/rs/zerolog/log"
 
 	"github.com/kalverra/crazed-nft-fans/config"
-	"github.com/kalverra/crazed-nft-fans/convert"
-	"github.com/kalverra/crazed-nft-fans/president"
 )
 
+// shutdownTimeout is how long to wait for in-flight requests to finish when shutting down
+const shutdownTimeout = 10 * time.Second
+
 func init() {
 	err := config.ReadConfig()
 	if err != nil {
@@ -22,21 +27,10 @@ func init() {
 }
 
 func main() {
-	router := buildRoutes()
-	err := president.WatchChain()
-	if err != nil {
-		log.Fatal().Err(err).Msg("Error watching chain")
-	}
-	err = president.RecruitFans(100)
-	if err != nil {
-		log.Fatal().Err(err).Msg("Error recruiting fans")
-	}
-	err = president.FundFans(convert.EtherToWei(big.NewFloat(100)))
-	if err != nil {
-		log.Fatal().Err(err).Msg("Error funding fans")
-	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	log.Info().Msg("Starting at http://localhost:3333")
-
-	log.Fatal().Err(router.ListenAndServe()).Msg("Error running router")
+	if err := runCLI(ctx, os.Args[1:]); err != nil {
+		log.Fatal().Err(err).Msg("Error running crazed-nft-fans")
+	}
 }
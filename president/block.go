@@ -0,0 +1,114 @@
+package president
+
+import (
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// TrackedBlock is a summary of a block the fans have been watching, and how their activity shows up in it
+type TrackedBlock struct {
+	Hash           string  `json:"hash"`
+	Number         uint64  `json:"number"`
+	Timestamp      uint64  `json:"timestamp"`
+	GasPrice       uint64  `json:"gasPrice"`       // Gas price suggested by the node when the block arrived
+	TargetGasPrice uint64  `json:"targetGasPrice"` // Target gas price the fans were aiming for
+	BaseFee        uint64  `json:"baseFee"`
+	GasUsed        uint64  `json:"gasUsed"`
+	GasLimit       uint64  `json:"gasLimit"`
+	PercentFilled  float64 `json:"percentFilled"`
+	TxCount        int     `json:"txCount"`
+	FanTxCount     int     `json:"fanTxCount"`
+	OtherTxCount   int     `json:"otherTxCount"`
+	// Effective priority fees paid by the block's transactions
+	MinPriorityFee    uint64 `json:"minPriorityFee"`
+	MedianPriorityFee uint64 `json:"medianPriorityFee"`
+	MaxPriorityFee    uint64 `json:"maxPriorityFee"`
+	// Average effective gas price paid, base fee plus priority fee, across the block's transactions
+	AvgGasPricePaid uint64 `json:"avgGasPricePaid"`
+	// Priority fees at each of the RewardPercentiles, as reported by eth_feeHistory
+	RewardPercentiles []float64 `json:"rewardPercentiles,omitempty"`
+	Rewards           []uint64  `json:"rewards,omitempty"`
+}
+
+// NewTrackedBlock summarizes a block, counting transactions sent from any of the fan addresses as fan transactions
+func NewTrackedBlock(
+	block *types.Block,
+	gasPrice, targetGasPrice *big.Int,
+	fanAddresses map[common.Address]struct{},
+) *TrackedBlock {
+	trackedBlock := &TrackedBlock{
+		Hash:           block.Hash().String(),
+		Number:         block.NumberU64(),
+		Timestamp:      block.Time(),
+		GasPrice:       gasPrice.Uint64(),
+		TargetGasPrice: targetGasPrice.Uint64(),
+		GasUsed:        block.GasUsed(),
+		GasLimit:       block.GasLimit(),
+		TxCount:        len(block.Transactions()),
+	}
+	if block.BaseFee() != nil {
+		trackedBlock.BaseFee = block.BaseFee().Uint64()
+	}
+	if block.GasLimit() > 0 {
+		trackedBlock.PercentFilled = float64(block.GasUsed()) / float64(block.GasLimit()) * 100
+	}
+
+	tips := make([]*big.Int, 0, len(block.Transactions()))
+	totalPaid := new(big.Int)
+	for _, tx := range block.Transactions() {
+		tip := tx.EffectiveGasTipValue(block.BaseFee())
+		tips = append(tips, tip)
+		totalPaid.Add(totalPaid, tip)
+		if block.BaseFee() != nil {
+			totalPaid.Add(totalPaid, block.BaseFee())
+		}
+		if isFanTransaction(tx, fanAddresses) {
+			trackedBlock.FanTxCount++
+		}
+	}
+	trackedBlock.OtherTxCount = trackedBlock.TxCount - trackedBlock.FanTxCount
+
+	if len(tips) > 0 {
+		sort.Slice(tips, func(i, j int) bool { return tips[i].Cmp(tips[j]) < 0 })
+		trackedBlock.MinPriorityFee = tips[0].Uint64()
+		trackedBlock.MedianPriorityFee = tips[len(tips)/2].Uint64()
+		trackedBlock.MaxPriorityFee = tips[len(tips)-1].Uint64()
+		trackedBlock.AvgGasPricePaid = totalPaid.Div(totalPaid, big.NewInt(int64(len(tips)))).Uint64()
+	}
+	return trackedBlock
+}
+
+// isFanTransaction determines if the transaction was sent by one of our fans
+func isFanTransaction(tx *types.Transaction, fanAddresses map[common.Address]struct{}) bool {
+	if len(fanAddresses) == 0 {
+		return false
+	}
+	sender, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil {
+		return false
+	}
+	_, ok := fanAddresses[sender]
+	return ok
+}
+
+// AddFeeHistory records the block's priority fee distribution from an eth_feeHistory response covering the block
+func (b *TrackedBlock) AddFeeHistory(feeHistory *ethereum.FeeHistory, percentiles []float64) {
+	if feeHistory == nil || feeHistory.OldestBlock == nil {
+		return
+	}
+	index := new(big.Int).SetUint64(b.Number)
+	index.Sub(index, feeHistory.OldestBlock)
+	if !index.IsUint64() || index.Uint64() >= uint64(len(feeHistory.Reward)) {
+		return
+	}
+	rewards := feeHistory.Reward[index.Uint64()]
+	b.RewardPercentiles = percentiles
+	b.Rewards = make([]uint64, 0, len(rewards))
+	for _, reward := range rewards {
+		b.Rewards = append(b.Rewards, reward.Uint64())
+	}
+}
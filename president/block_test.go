@@ -0,0 +1,89 @@
+package president_test
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kalverra/crazed-nft-fans/president"
+)
+
+var testChainID = big.NewInt(1337)
+
+func signedTx(t *testing.T, key *ecdsa.PrivateKey, nonce uint64, tipCap int64) *types.Transaction {
+	t.Helper()
+	to := common.HexToAddress("0x42")
+	tx, err := types.SignNewTx(key, types.LatestSignerForChainID(testChainID), &types.DynamicFeeTx{
+		ChainID:   testChainID,
+		Nonce:     nonce,
+		To:        &to,
+		Gas:       21_000,
+		GasTipCap: big.NewInt(tipCap),
+		GasFeeCap: big.NewInt(tipCap + 1000),
+	})
+	require.NoError(t, err, "Error signing transaction")
+	return tx
+}
+
+func TestNewTrackedBlock(t *testing.T) {
+	fanKey, err := crypto.GenerateKey()
+	require.NoError(t, err, "Error generating key")
+	otherKey, err := crypto.GenerateKey()
+	require.NoError(t, err, "Error generating key")
+
+	txs := []*types.Transaction{
+		signedTx(t, fanKey, 0, 30),
+		signedTx(t, fanKey, 1, 10),
+		signedTx(t, otherKey, 0, 20),
+	}
+	header := &types.Header{
+		Number:   big.NewInt(10),
+		Time:     1234,
+		GasLimit: 100_000,
+		GasUsed:  63_000,
+		BaseFee:  big.NewInt(500),
+	}
+	block := types.NewBlockWithHeader(header).WithBody(txs, nil)
+	fanAddresses := map[common.Address]struct{}{crypto.PubkeyToAddress(fanKey.PublicKey): {}}
+
+	tracked := president.NewTrackedBlock(block, big.NewInt(700), big.NewInt(35), fanAddresses)
+	require.Equal(t, uint64(10), tracked.Number)
+	require.Equal(t, uint64(1234), tracked.Timestamp)
+	require.Equal(t, uint64(700), tracked.GasPrice)
+	require.Equal(t, uint64(35), tracked.TargetGasPrice)
+	require.Equal(t, uint64(500), tracked.BaseFee)
+	require.InDelta(t, 63.0, tracked.PercentFilled, 0.001)
+	require.Equal(t, 3, tracked.TxCount)
+	require.Equal(t, 2, tracked.FanTxCount)
+	require.Equal(t, 1, tracked.OtherTxCount)
+	require.Equal(t, uint64(10), tracked.MinPriorityFee)
+	require.Equal(t, uint64(20), tracked.MedianPriorityFee)
+	require.Equal(t, uint64(30), tracked.MaxPriorityFee)
+	require.Equal(t, uint64(520), tracked.AvgGasPricePaid)
+}
+
+func TestAddFeeHistory(t *testing.T) {
+	percentiles := []float64{10, 50, 90}
+	feeHistory := &ethereum.FeeHistory{
+		OldestBlock: big.NewInt(9),
+		Reward: [][]*big.Int{
+			{big.NewInt(1), big.NewInt(2), big.NewInt(3)},
+			{big.NewInt(4), big.NewInt(5), big.NewInt(6)},
+		},
+	}
+
+	tracked := &president.TrackedBlock{Number: 10}
+	tracked.AddFeeHistory(feeHistory, percentiles)
+	require.Equal(t, percentiles, tracked.RewardPercentiles)
+	require.Equal(t, []uint64{4, 5, 6}, tracked.Rewards)
+
+	outOfRange := &president.TrackedBlock{Number: 20}
+	outOfRange.AddFeeHistory(feeHistory, percentiles)
+	require.Empty(t, outOfRange.Rewards, "Block outside of the fee history shouldn't get rewards")
+}
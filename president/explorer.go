@@ -0,0 +1,50 @@
+package president
+
+import (
+	"strings"
+
+	"github.com/kalverra/crazed-nft-fans/fans"
+)
+
+// Strategy is how fans are deciding when, how much, and at what price to send
+type Strategy struct {
+	SendMode SendMode        `json:"sendMode"`
+	Rate     fans.RateConfig `json:"rate"`
+	Tip      string          `json:"tip"`
+}
+
+// FanInfo is what a fan is up to, and the strategy it's following
+type FanInfo struct {
+	fans.Info
+	Strategy Strategy `json:"strategy"`
+}
+
+// CurrentStrategy describes the strategy every fan is currently following
+func CurrentStrategy() Strategy {
+	return Strategy{
+		SendMode: CurrentSendMode(),
+		Rate:     TransactionRate(),
+		Tip:      fans.TipStrategy,
+	}
+}
+
+// FanInfos describes every fan, including those still retiring
+func FanInfos() []FanInfo {
+	strategy := CurrentStrategy()
+	listening := listeningFans()
+	infos := make([]FanInfo, 0, len(listening))
+	for _, fan := range listening {
+		infos = append(infos, FanInfo{Info: fan.Info(), Strategy: strategy})
+	}
+	return infos
+}
+
+// FanByAddress finds a fan, including those still retiring, by its hex address
+func FanByAddress(address string) (*fans.Fan, bool) {
+	for _, fan := range listeningFans() {
+		if strings.EqualFold(fan.Address.Hex(), address) {
+			return fan, true
+		}
+	}
+	return nil, false
+}
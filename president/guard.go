@@ -0,0 +1,85 @@
+package president
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/kalverra/crazed-nft-fans/config"
+	"github.com/kalverra/crazed-nft-fans/convert"
+)
+
+// ErrSpendCapReached is returned when funding a fan would send more than SPEND_CAP to the fans
+var ErrSpendCapReached = errors.New("spend cap reached")
+
+// publicChains are chain IDs where the ETH is worth real money, or is at least shared with people who'd be upset
+var publicChains = map[uint64]string{
+	1:        "Ethereum mainnet",
+	10:       "Optimism",
+	56:       "BNB Smart Chain",
+	100:      "Gnosis",
+	137:      "Polygon",
+	250:      "Fantom",
+	324:      "zkSync Era",
+	8453:     "Base",
+	42161:    "Arbitrum One",
+	43114:    "Avalanche C-Chain",
+	59144:    "Linea",
+	5:        "Goerli",
+	17000:    "Holesky",
+	80001:    "Polygon Mumbai",
+	84532:    "Base Sepolia",
+	421614:   "Arbitrum Sepolia",
+	11155111: "Sepolia",
+}
+
+var (
+	fundingCapMu sync.Mutex
+	fundingSent  = big.NewInt(0) // wei sent to fans from the funding address this run, counted against SPEND_CAP
+)
+
+// checkSafety refuses to run on known public chains, or with a funder holding more than MAX_FUNDING_BALANCE, unless
+// ALLOW_PUBLIC_CHAIN is set
+func checkSafety(chainID, fundingBalance *big.Int) error {
+	problems := []error{}
+	if name, public := publicChains[chainID.Uint64()]; chainID.IsUint64() && public {
+		problems = append(problems, fmt.Errorf("chain %s is %s, a public chain", chainID, name))
+	}
+	maxBalance := config.Current.MaxFundingBalanceWei
+	if maxBalance != nil && fundingBalance.Cmp(maxBalance) > 0 {
+		problems = append(problems, fmt.Errorf("funding address %s holds %s ETH, more than MAX_FUNDING_BALANCE of %s ETH",
+			config.Current.FundingAddress.Hex(), convert.WeiToEther(fundingBalance).String(), convert.WeiToEther(maxBalance).String()))
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	if config.Current.AllowPublicChain {
+		log.Warn().Err(errors.Join(problems...)).Msg("Running anyway, because ALLOW_PUBLIC_CHAIN is set")
+		return nil
+	}
+	return fmt.Errorf("refusing to run, set ALLOW_PUBLIC_CHAIN or --allow-public-chain if you're sure: %w", errors.Join(problems...))
+}
+
+// reserveFunding counts wei as sent to a fan, unless it would take the run past SPEND_CAP. Wei is counted before the
+// funding transaction is sent, and stays counted even if it fails, so the cap errs on the side of sending too little.
+func reserveFunding(wei *big.Int) error {
+	fundingCapMu.Lock()
+	defer fundingCapMu.Unlock()
+	sent := new(big.Int).Add(fundingSent, wei)
+	spendCap := config.Current.SpendCapWei
+	if spendCap != nil && spendCap.Sign() > 0 && sent.Cmp(spendCap) > 0 {
+		return fmt.Errorf("%w: sent %s of %s wei to fans", ErrSpendCapReached, fundingSent, spendCap)
+	}
+	fundingSent = sent
+	return nil
+}
+
+// FundingSent returns how much wei has been sent to fans from the funding address this run
+func FundingSent() *big.Int {
+	fundingCapMu.Lock()
+	defer fundingCapMu.Unlock()
+	return new(big.Int).Set(fundingSent)
+}
@@ -0,0 +1,73 @@
+package president
+
+import (
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kalverra/crazed-nft-fans/config"
+)
+
+// useConfig swaps in a config for the length of a test
+func useConfig(t *testing.T, conf *config.Config) {
+	previous := config.Current
+	config.Current = conf
+	t.Cleanup(func() { config.Current = previous })
+}
+
+func TestCheckSafety(t *testing.T) {
+	conf := &config.Config{MaxFundingBalanceWei: big.NewInt(1000)}
+	useConfig(t, conf)
+
+	require.NoError(t, checkSafety(big.NewInt(1337), big.NewInt(1000)), "Dev chain with a small funder should run")
+	require.Error(t, checkSafety(big.NewInt(1), big.NewInt(0)), "Mainnet should be refused")
+	require.Error(t, checkSafety(big.NewInt(11155111), big.NewInt(0)), "Sepolia should be refused")
+	require.Error(t, checkSafety(big.NewInt(1337), big.NewInt(1001)), "Well funded funder should be refused")
+
+	conf.AllowPublicChain = true
+	require.NoError(t, checkSafety(big.NewInt(1), big.NewInt(1001)), "Override should let everything run")
+
+	conf.AllowPublicChain, conf.MaxFundingBalanceWei = false, big.NewInt(0)
+	require.Error(t, checkSafety(big.NewInt(1337), big.NewInt(1)), "0 shouldn't turn the balance limit off")
+}
+
+func TestCheckSafetyBundledGenesis(t *testing.T) {
+	previous := config.Current
+	t.Cleanup(func() { config.Current = previous })
+	require.NoError(t, config.ReadConfig(), "Error reading default config")
+
+	raw, err := os.ReadFile(filepath.Join("..", "geth_settings", "genesis.json"))
+	require.NoError(t, err, "Error reading bundled genesis")
+	genesis := struct {
+		Config struct {
+			ChainID *big.Int `json:"chainId"`
+		} `json:"config"`
+		Alloc map[common.Address]struct {
+			Balance *math.HexOrDecimal256 `json:"balance"`
+		} `json:"alloc"`
+	}{}
+	require.NoError(t, json.Unmarshal(raw, &genesis), "Error parsing bundled genesis")
+	funder, ok := genesis.Alloc[config.Current.FundingAddress]
+	require.True(t, ok, "Bundled genesis should fund the default funding address")
+
+	require.NoError(t, checkSafety(genesis.Config.ChainID, (*big.Int)(funder.Balance)),
+		"The bundled test node's funder should pass with the default config")
+}
+
+func TestSpendCap(t *testing.T) {
+	useConfig(t, &config.Config{SpendCapWei: big.NewInt(250)})
+	t.Cleanup(func() { fundingSent = big.NewInt(0) })
+	fundingSent = big.NewInt(0)
+
+	require.NoError(t, reserveFunding(big.NewInt(100)))
+	require.NoError(t, reserveFunding(big.NewInt(100)))
+	require.ErrorIs(t, reserveFunding(big.NewInt(100)), ErrSpendCapReached, "Third funding would cross the cap")
+	require.Equal(t, int64(200), FundingSent().Int64(), "Refused funding shouldn't be counted")
+	require.NoError(t, reserveFunding(big.NewInt(50)), "Funding right up to the cap is fine")
+}
@@ -0,0 +1,297 @@
+package president
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	trackedMu sync.RWMutex
+	history   = newBlockHistory(10000)
+)
+
+// blockHistory is a bounded ring buffer of tracked blocks, ordered by block number. Blocks can optionally be persisted
+// to an append-only file of JSON lines so that history survives restarts, and older ranges can still be queried.
+type blockHistory struct {
+	blocks []*TrackedBlock
+	start  int // index of the oldest block in blocks
+	count  int
+
+	path string
+	file *os.File
+
+	runStart   uint64 // number of the first block tracked by this process
+	runStarted bool
+}
+
+func newBlockHistory(size int) *blockHistory {
+	if size < 1 {
+		size = 1
+	}
+	return &blockHistory{blocks: make([]*TrackedBlock, size)}
+}
+
+// OpenBlockHistory sets up block history with the given retention, loading and persisting to the file at path if
+// it's not empty
+func OpenBlockHistory(size int, path string) error {
+	trackedMu.Lock()
+	defer trackedMu.Unlock()
+
+	if err := history.close(); err != nil {
+		return err
+	}
+	newHistory := newBlockHistory(size)
+	if path != "" {
+		if err := newHistory.load(path); err != nil {
+			return err
+		}
+		log.Info().Str("File", path).Int("Loaded", newHistory.count).Msg("Loaded block history")
+	}
+	history = newHistory
+	return nil
+}
+
+// CloseBlockHistory flushes and closes the block history file, if there is one
+func CloseBlockHistory() error {
+	trackedMu.Lock()
+	defer trackedMu.Unlock()
+	return history.close()
+}
+
+// TrackBlock adds another block to our tracked group
+func TrackBlock(block *TrackedBlock) {
+	trackedMu.Lock()
+	defer trackedMu.Unlock()
+
+	if !history.runStarted {
+		history.runStart, history.runStarted = block.Number, true
+	}
+	history.add(block)
+	if err := history.persist(block); err != nil {
+		log.Error().Err(err).Str("File", history.path).Uint64("Number", block.Number).Msg("Error persisting block")
+	}
+}
+
+// AllBlocks returns every block currently held in memory, oldest first
+func AllBlocks() []*TrackedBlock {
+	trackedMu.RLock()
+	defer trackedMu.RUnlock()
+
+	blocks := make([]*TrackedBlock, 0, history.count)
+	for i := 0; i < history.count; i++ {
+		blocks = append(blocks, history.at(i))
+	}
+	return blocks
+}
+
+// BlocksSinceNumber returns all blocks held in memory after the given block number
+func BlocksSinceNumber(number uint64) []*TrackedBlock {
+	trackedMu.RLock()
+	defer trackedMu.RUnlock()
+
+	blocks := []*TrackedBlock{}
+	for i := history.search(number + 1); i < history.count; i++ {
+		blocks = append(blocks, history.at(i))
+	}
+	return blocks
+}
+
+// BlocksInRange returns all blocks with numbers between from and to, inclusive. If the range reaches further back
+// than what's held in memory, the persisted history file is read to fill it in, without holding up new blocks.
+func BlocksInRange(from, to uint64) ([]*TrackedBlock, error) {
+	if from > to {
+		return []*TrackedBlock{}, nil
+	}
+	trackedMu.RLock()
+	if history.path == "" || (history.count > 0 && from >= history.at(0).Number) {
+		defer trackedMu.RUnlock()
+		return history.inMemory(from, to), nil
+	}
+	path := history.path
+	written, err := history.written()
+	trackedMu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	// The file is only ever appended to, so everything up to what had been written is safe to read without the lock
+	return readRange(path, written, from, to)
+}
+
+// RunBlocks returns every block tracked since this process started, leaving out blocks loaded from the history file
+// that earlier runs tracked
+func RunBlocks() ([]*TrackedBlock, error) {
+	trackedMu.RLock()
+	from, started := history.runStart, history.runStarted
+	trackedMu.RUnlock()
+	if !started {
+		return []*TrackedBlock{}, nil
+	}
+	return BlocksInRange(from, math.MaxUint64)
+}
+
+// LatestBlock returns the most recently tracked block, or nil if there are none
+func LatestBlock() *TrackedBlock {
+	trackedMu.RLock()
+	defer trackedMu.RUnlock()
+
+	if history.count == 0 {
+		return nil
+	}
+	return history.at(history.count - 1)
+}
+
+// inMemory returns the blocks held in memory with numbers between from and to, inclusive
+func (h *blockHistory) inMemory(from, to uint64) []*TrackedBlock {
+	blocks := []*TrackedBlock{}
+	for i := h.search(from); i < h.count; i++ {
+		block := h.at(i)
+		if block.Number > to {
+			break
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+// at returns the i'th oldest block
+func (h *blockHistory) at(i int) *TrackedBlock {
+	return h.blocks[(h.start+i)%len(h.blocks)]
+}
+
+// search finds the index of the first block with a number of at least the one given
+func (h *blockHistory) search(number uint64) int {
+	return sort.Search(h.count, func(i int) bool {
+		return h.at(i).Number >= number
+	})
+}
+
+// add pushes a new block, evicting the oldest if we're full. If the block is at or behind our newest one (a reorg),
+// the stale blocks are dropped first.
+func (h *blockHistory) add(block *TrackedBlock) {
+	for h.count > 0 && h.at(h.count-1).Number >= block.Number {
+		h.count--
+	}
+	if h.count == len(h.blocks) {
+		h.start = (h.start + 1) % len(h.blocks)
+		h.count--
+	}
+	h.blocks[(h.start+h.count)%len(h.blocks)] = block
+	h.count++
+}
+
+// load reads all previously persisted blocks from path, keeping the newest, then opens it for appending
+func (h *blockHistory) load(path string) error {
+	if err := scan(path, -1, func(block *TrackedBlock) bool {
+		h.add(block)
+		return true
+	}); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	h.path, h.file = path, file
+	return nil
+}
+
+// written returns how many bytes of the history file have been written. The caller must hold trackedMu.
+func (h *blockHistory) written() (int64, error) {
+	var (
+		info os.FileInfo
+		err  error
+	)
+	if h.file != nil {
+		info, err = h.file.Stat()
+	} else {
+		info, err = os.Stat(h.path)
+	}
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// readRange scans the first size bytes of the history file at path for blocks between from and to, inclusive
+func readRange(path string, size int64, from, to uint64) ([]*TrackedBlock, error) {
+	byNumber := map[uint64]*TrackedBlock{}
+	err := scan(path, size, func(block *TrackedBlock) bool {
+		if block.Number >= from && block.Number <= to {
+			byNumber[block.Number] = block // later entries win on reorgs
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	blocks := make([]*TrackedBlock, 0, len(byNumber))
+	for _, block := range byNumber {
+		blocks = append(blocks, block)
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].Number < blocks[j].Number })
+	return blocks, nil
+}
+
+// scan decodes each block in the first limit bytes of the file at path, or all of it if limit is negative, calling
+// onBlock until it returns false. A missing file is not an error.
+func scan(path string, limit int64, onBlock func(*TrackedBlock) bool) error {
+	file, err := os.Open(path) // #nosec G304 - path is operator supplied config
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if limit >= 0 {
+		reader = io.LimitReader(file, limit)
+	}
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		block := &TrackedBlock{}
+		if err := json.Unmarshal(scanner.Bytes(), block); err != nil {
+			log.Warn().Err(err).Str("File", path).Msg("Skipping unreadable block history line")
+			continue
+		}
+		if !onBlock(block) {
+			break
+		}
+	}
+	return scanner.Err()
+}
+
+// persist appends the block to the history file, if there is one
+func (h *blockHistory) persist(block *TrackedBlock) error {
+	if h.file == nil {
+		return nil
+	}
+	line, err := json.Marshal(block)
+	if err != nil {
+		return err
+	}
+	_, err = h.file.Write(append(line, '\n'))
+	return err
+}
+
+func (h *blockHistory) close() error {
+	if h.file == nil {
+		return nil
+	}
+	err := h.file.Close()
+	h.file = nil
+	return err
+}
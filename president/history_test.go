@@ -0,0 +1,83 @@
+package president_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kalverra/crazed-nft-fans/president"
+)
+
+func blockNumbers(blocks []*president.TrackedBlock) []uint64 {
+	numbers := make([]uint64, 0, len(blocks))
+	for _, block := range blocks {
+		numbers = append(numbers, block.Number)
+	}
+	return numbers
+}
+
+func TestBlockHistoryBounded(t *testing.T) {
+	require.NoError(t, president.OpenBlockHistory(3, ""), "Error opening block history")
+	for number := uint64(100); number < 105; number++ {
+		president.TrackBlock(&president.TrackedBlock{Number: number})
+	}
+
+	require.Equal(t, []uint64{102, 103, 104}, blockNumbers(president.AllBlocks()))
+	require.Equal(t, []uint64{104}, blockNumbers(president.BlocksSinceNumber(103)))
+	require.Equal(t, uint64(104), president.LatestBlock().Number)
+
+	// Reorg replaces everything from the re-sent block onwards
+	president.TrackBlock(&president.TrackedBlock{Number: 103, Hash: "reorg"})
+	require.Equal(t, []uint64{102, 103}, blockNumbers(president.AllBlocks()))
+	require.Equal(t, "reorg", president.LatestBlock().Hash)
+}
+
+func TestBlockHistoryPersisted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocks.jsonl")
+	require.NoError(t, president.OpenBlockHistory(2, path), "Error opening block history")
+	for number := uint64(1); number <= 5; number++ {
+		president.TrackBlock(&president.TrackedBlock{Number: number})
+	}
+	require.NoError(t, president.CloseBlockHistory(), "Error closing block history")
+
+	require.NoError(t, president.OpenBlockHistory(2, path), "Error re-opening block history")
+	t.Cleanup(func() { require.NoError(t, president.CloseBlockHistory()) })
+	require.Equal(t, []uint64{4, 5}, blockNumbers(president.AllBlocks()))
+	blocks, err := president.RunBlocks()
+	require.NoError(t, err, "Error reading run blocks")
+	require.Empty(t, blocks, "Blocks loaded from an earlier run shouldn't count as this run's")
+
+	blocks, err = president.BlocksInRange(2, 4)
+	require.NoError(t, err, "Error reading block range")
+	require.Equal(t, []uint64{2, 3, 4}, blockNumbers(blocks))
+
+	// Reading the file shouldn't get in the way of new blocks, or trip over the ones being written
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for number := uint64(6); number <= 200; number++ {
+			president.TrackBlock(&president.TrackedBlock{Number: number})
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		blocks, err = president.BlocksInRange(2, 4)
+		require.NoError(t, err, "Error reading block range while blocks are tracked")
+		require.Equal(t, []uint64{2, 3, 4}, blockNumbers(blocks))
+	}
+	<-done
+
+	blocks, err = president.RunBlocks()
+	require.NoError(t, err, "Error reading run blocks")
+	require.Len(t, blocks, 195, "Every block tracked this run should be read back, even once it's out of memory")
+	require.Equal(t, uint64(6), blocks[0].Number)
+}
+
+func TestBlockInterval(t *testing.T) {
+	require.NoError(t, president.OpenBlockHistory(100, ""), "Error opening block history")
+	for number := uint64(1); number <= 20; number++ {
+		president.TrackBlock(&president.TrackedBlock{Number: number, Timestamp: 1000 + number*3})
+	}
+	require.Equal(t, 3*time.Second, president.BlockInterval())
+}
@@ -0,0 +1,106 @@
+package president
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/rs/zerolog/log"
+
+	"github.com/kalverra/crazed-nft-fans/config"
+	"github.com/kalverra/crazed-nft-fans/fans"
+)
+
+// fanKeysMu guards writes to the fan keys file
+var fanKeysMu sync.Mutex
+
+// recruitFan creates a new fan, saving its key to the fan keys file if there is one
+func recruitFan(ctx context.Context) (*fans.Fan, error) {
+	fan, err := fans.New(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	useEndpoints(fan)
+	return fan, saveFanKey(config.Current.FanKeysFile, fan.PrivateKey)
+}
+
+// saveFanKey appends a fan's private key to the file at path, doing nothing if path is empty
+func saveFanKey(path string, key *ecdsa.PrivateKey) error {
+	if path == "" {
+		return nil
+	}
+	fanKeysMu.Lock()
+	defer fanKeysMu.Unlock()
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = fmt.Fprintln(file, hex.EncodeToString(crypto.FromECDSA(key))); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// readFanKeys reads every distinct private key saved to the file at path, in the order they were saved
+func readFanKeys(path string) ([]*ecdsa.PrivateKey, error) {
+	file, err := os.Open(path) // #nosec G304 - path is operator supplied config
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	keys := []*ecdsa.PrivateKey{}
+	seen := map[common.Address]struct{}{}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		key, err := crypto.HexToECDSA(text)
+		if err != nil {
+			return nil, fmt.Errorf("bad fan key on line %d of %s: %w", line, path, err)
+		}
+		address := crypto.PubkeyToAddress(key.PublicKey)
+		if _, ok := seen[address]; ok {
+			continue
+		}
+		seen[address] = struct{}{}
+		keys = append(keys, key)
+	}
+	return keys, scanner.Err()
+}
+
+// LoadFans brings the fans saved to the fan keys file back into the club, returning how many joined
+func LoadFans(ctx context.Context) (int, error) {
+	if config.Current.FanKeysFile == "" {
+		return 0, nil
+	}
+	keys, err := readFanKeys(config.Current.FanKeysFile)
+	if err != nil {
+		return 0, err
+	}
+	for _, key := range keys {
+		fan, err := fans.NewFromKey(ctx, client, key)
+		if err != nil {
+			return 0, err
+		}
+		useEndpoints(fan)
+		joinClub(fan)
+	}
+	log.Info().Int("Count", len(keys)).Str("File", config.Current.FanKeysFile).Msg("Loaded saved fans")
+	return len(keys), nil
+}
@@ -0,0 +1,30 @@
+package president
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFanKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fan_keys.txt")
+	keys, err := readFanKeys(path)
+	require.NoError(t, err, "Missing keys file should just mean no saved fans")
+	require.Empty(t, keys)
+
+	first, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	second, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	require.NoError(t, saveFanKey(path, first))
+	require.NoError(t, saveFanKey(path, second))
+	require.NoError(t, saveFanKey(path, first))
+
+	keys, err = readFanKeys(path)
+	require.NoError(t, err, "Error reading fan keys")
+	require.Len(t, keys, 2, "Duplicate keys should be skipped")
+	require.Equal(t, crypto.PubkeyToAddress(first.PublicKey), crypto.PubkeyToAddress(keys[0].PublicKey))
+	require.Equal(t, crypto.PubkeyToAddress(second.PublicKey), crypto.PubkeyToAddress(keys[1].PublicKey))
+}
@@ -0,0 +1,54 @@
+package president
+
+import (
+	"sort"
+
+	"github.com/kalverra/crazed-nft-fans/fans"
+)
+
+// LatencyPercentiles are the inclusion latency percentiles reported for each block
+var LatencyPercentiles = []float64{50, 90, 99}
+
+// BlockLatency is how long the fan transactions included in a block took to get there
+type BlockLatency struct {
+	Number       uint64    `json:"number"`
+	Transactions int       `json:"transactions"`
+	Percentiles  []float64 `json:"percentiles"`
+	LatenciesMs  []int64   `json:"latenciesMs"` // Latency at each of the Percentiles
+}
+
+// InclusionLatency groups the confirmed transactions fans remember by block, and reports the latency percentiles
+// for each block in ascending order. Fans only remember their last TX_HISTORY_SIZE transactions, so on long runs the
+// earliest blocks are left out, or only counted in part.
+func InclusionLatency() []BlockLatency {
+	byBlock := map[uint64][]int64{}
+	for _, fan := range listeningFans() {
+		for _, record := range fan.Transactions() {
+			if record.Kind != fans.KindRandom || record.Status != fans.StatusConfirmed {
+				continue
+			}
+			byBlock[record.BlockNumber] = append(byBlock[record.BlockNumber], record.LatencyMs)
+		}
+	}
+	return blockLatencies(byBlock, LatencyPercentiles)
+}
+
+func blockLatencies(byBlock map[uint64][]int64, percentiles []float64) []BlockLatency {
+	latencies := make([]BlockLatency, 0, len(byBlock))
+	for number, blockLatencies := range byBlock {
+		sort.Slice(blockLatencies, func(i, j int) bool { return blockLatencies[i] < blockLatencies[j] })
+		latency := BlockLatency{
+			Number:       number,
+			Transactions: len(blockLatencies),
+			Percentiles:  percentiles,
+			LatenciesMs:  make([]int64, 0, len(percentiles)),
+		}
+		for _, percentile := range percentiles {
+			index := int(percentile / 100 * float64(len(blockLatencies)-1))
+			latency.LatenciesMs = append(latency.LatenciesMs, blockLatencies[index])
+		}
+		latencies = append(latencies, latency)
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i].Number < latencies[j].Number })
+	return latencies
+}
@@ -0,0 +1,21 @@
+package president
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockLatencies(t *testing.T) {
+	latencies := blockLatencies(map[uint64][]int64{
+		12: {900, 100, 500, 300, 700},
+		11: {2000},
+	}, []float64{0, 50, 100})
+
+	require.Len(t, latencies, 2)
+	require.Equal(t, uint64(11), latencies[0].Number, "Blocks should be in ascending order")
+	require.Equal(t, []int64{2000, 2000, 2000}, latencies[0].LatenciesMs)
+	require.Equal(t, uint64(12), latencies[1].Number)
+	require.Equal(t, 5, latencies[1].Transactions)
+	require.Equal(t, []int64{100, 500, 900}, latencies[1].LatenciesMs)
+}
@@ -0,0 +1,227 @@
+package president
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/rs/zerolog/log"
+
+	"github.com/kalverra/crazed-nft-fans/config"
+)
+
+// methodNotFoundCode is the JSON-RPC error code for calling a method the node doesn't serve
+const methodNotFoundCode = -32601
+
+// maxMempoolSnapshots is how many mempool snapshots to keep around
+const maxMempoolSnapshots = 1000
+
+// MempoolSnapshot is a point in time view of the node's transaction pool
+type MempoolSnapshot struct {
+	Time         time.Time `json:"time"`
+	Pending      uint64    `json:"pending"`
+	Queued       uint64    `json:"queued"`
+	FanPending   uint64    `json:"fanPending"`
+	FanQueued    uint64    `json:"fanQueued"`
+	ContentKnown bool      `json:"contentKnown"` // Whether txpool_content was available to break down the pool
+	// Effective tips of the pending transactions at the latest base fee, at each of the TipPercentiles
+	TipPercentiles []float64 `json:"tipPercentiles,omitempty"`
+	Tips           []uint64  `json:"tips,omitempty"`
+}
+
+// MempoolStatus shows whether the mempool can be monitored, and what it's looked like
+type MempoolStatus struct {
+	Available bool               `json:"available"`
+	Latest    *MempoolSnapshot   `json:"latest,omitempty"`
+	History   []*MempoolSnapshot `json:"history"`
+}
+
+var (
+	mempoolMu        sync.RWMutex
+	mempoolSnapshots = []*MempoolSnapshot{}
+	mempoolAvailable = false
+)
+
+// txPoolStatus is the response from txpool_status
+type txPoolStatus struct {
+	Pending hexutil.Uint64 `json:"pending"`
+	Queued  hexutil.Uint64 `json:"queued"`
+}
+
+// txPoolTransaction holds the fields we care about from each transaction in txpool_content
+type txPoolTransaction struct {
+	GasPrice             *hexutil.Big `json:"gasPrice"`
+	MaxFeePerGas         *hexutil.Big `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *hexutil.Big `json:"maxPriorityFeePerGas"`
+}
+
+// effectiveTip is what the transaction would tip a validator at baseFee, never less than 0. Without a base fee it's
+// the most the transaction would tip, or nil if it doesn't say.
+func (tx *txPoolTransaction) effectiveTip(baseFee *big.Int) *big.Int {
+	feeCap, tip := tx.GasPrice, tx.GasPrice
+	if tx.MaxFeePerGas != nil && tx.MaxPriorityFeePerGas != nil {
+		feeCap, tip = tx.MaxFeePerGas, tx.MaxPriorityFeePerGas
+	}
+	if feeCap == nil {
+		return nil
+	}
+	if baseFee == nil {
+		return new(big.Int).Set(tip.ToInt())
+	}
+	effective := new(big.Int).Sub(feeCap.ToInt(), baseFee)
+	if effective.Cmp(tip.ToInt()) > 0 {
+		effective.Set(tip.ToInt())
+	}
+	if effective.Sign() < 0 {
+		effective.SetInt64(0)
+	}
+	return effective
+}
+
+// txPoolContent is the response from txpool_content, transactions keyed by sender then nonce
+type txPoolContent struct {
+	Pending map[common.Address]map[string]*txPoolTransaction `json:"pending"`
+	Queued  map[common.Address]map[string]*txPoolTransaction `json:"queued"`
+}
+
+// Mempool returns the current state of mempool monitoring
+func Mempool() *MempoolStatus {
+	mempoolMu.RLock()
+	defer mempoolMu.RUnlock()
+
+	status := &MempoolStatus{
+		Available: mempoolAvailable,
+		History:   append([]*MempoolSnapshot{}, mempoolSnapshots...),
+	}
+	if len(mempoolSnapshots) > 0 {
+		status.Latest = mempoolSnapshots[len(mempoolSnapshots)-1]
+	}
+	return status
+}
+
+// watchMempool polls the node's txpool namespace on an interval until it finds the namespace isn't available
+func watchMempool(ctx context.Context, rpcClient *rpc.Client, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	contentAvailable := true
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		snapshot := &MempoolSnapshot{Time: time.Now()}
+		status := &txPoolStatus{}
+		err := rpcLimiter.Do(ctx, func(ctx context.Context) error {
+			return rpcClient.CallContext(ctx, status, "txpool_status")
+		})
+		if err != nil {
+			if isMethodNotFound(err) {
+				log.Warn().Err(err).Msg("Node doesn't support txpool_status, no longer monitoring the mempool")
+				return
+			}
+			if ctx.Err() == nil {
+				log.Error().Err(err).Msg("Error getting mempool status")
+			}
+			continue
+		}
+		snapshot.Pending, snapshot.Queued = uint64(status.Pending), uint64(status.Queued)
+
+		if contentAvailable {
+			content := &txPoolContent{}
+			err := rpcLimiter.Do(ctx, func(ctx context.Context) error {
+				return rpcClient.CallContext(ctx, content, "txpool_content")
+			})
+			switch {
+			case ctx.Err() != nil:
+				return
+			case isMethodNotFound(err):
+				log.Warn().Err(err).Msg("Node doesn't support txpool_content, only tracking mempool counts")
+				contentAvailable = false
+			case err != nil:
+				log.Error().Err(err).Msg("Error getting mempool content")
+			default:
+				snapshot.addContent(content, fanAddresses(), trackedBaseFee(), config.Current.MempoolTipPercentiles)
+			}
+		}
+
+		recordMempoolSnapshot(snapshot)
+		log.Debug().
+			Uint64("Pending", snapshot.Pending).
+			Uint64("Queued", snapshot.Queued).
+			Uint64("Fan Pending", snapshot.FanPending).
+			Msg("Mempool")
+	}
+}
+
+// addContent breaks down the pool's contents into fan transactions and the distribution of the pending set's
+// effective tips at baseFee
+func (s *MempoolSnapshot) addContent(
+	content *txPoolContent,
+	fanAddresses map[common.Address]struct{},
+	baseFee *big.Int,
+	percentiles []float64,
+) {
+	s.ContentKnown = true
+	tips := []*big.Int{}
+	for sender, txs := range content.Pending {
+		if _, isFan := fanAddresses[sender]; isFan {
+			s.FanPending += uint64(len(txs))
+		}
+		for _, tx := range txs {
+			if tip := tx.effectiveTip(baseFee); tip != nil {
+				tips = append(tips, tip)
+			}
+		}
+	}
+	for sender, txs := range content.Queued {
+		if _, isFan := fanAddresses[sender]; isFan {
+			s.FanQueued += uint64(len(txs))
+		}
+	}
+
+	if len(tips) == 0 || len(percentiles) == 0 {
+		return
+	}
+	sort.Slice(tips, func(i, j int) bool { return tips[i].Cmp(tips[j]) < 0 })
+	s.TipPercentiles = percentiles
+	s.Tips = make([]uint64, 0, len(percentiles))
+	for _, percentile := range percentiles {
+		index := int(percentile / 100 * float64(len(tips)-1))
+		s.Tips = append(s.Tips, tips[index].Uint64())
+	}
+}
+
+// trackedBaseFee is the base fee of the latest tracked block, nil if there isn't one yet or the chain has no base fee
+func trackedBaseFee() *big.Int {
+	latest := LatestBlock()
+	if latest == nil || latest.BaseFee == 0 {
+		return nil
+	}
+	return new(big.Int).SetUint64(latest.BaseFee)
+}
+
+func recordMempoolSnapshot(snapshot *MempoolSnapshot) {
+	mempoolMu.Lock()
+	defer mempoolMu.Unlock()
+
+	mempoolAvailable = true
+	mempoolSnapshots = append(mempoolSnapshots, snapshot)
+	if len(mempoolSnapshots) > maxMempoolSnapshots {
+		mempoolSnapshots = mempoolSnapshots[len(mempoolSnapshots)-maxMempoolSnapshots:]
+	}
+}
+
+func isMethodNotFound(err error) bool {
+	var rpcErr rpc.Error
+	return errors.As(err, &rpcErr) && rpcErr.ErrorCode() == methodNotFoundCode
+}
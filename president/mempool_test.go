@@ -0,0 +1,55 @@
+package president
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+// txPoolContentFixture is a txpool_content response with a fan's transactions, and someone else's legacy and
+// dynamic fee ones, one of which can't pay a base fee of 100
+const txPoolContentFixture = `{
+	"pending": {
+		"0x0000000000000000000000000000000000000001": {
+			"0": {"gasPrice": "0x12c", "maxFeePerGas": "0x12c", "maxPriorityFeePerGas": "0x32"},
+			"1": {"gasPrice": "0x78", "maxFeePerGas": "0x78", "maxPriorityFeePerGas": "0x32"}
+		},
+		"0x0000000000000000000000000000000000000002": {
+			"5": {"gasPrice": "0xfa"},
+			"6": {"gasPrice": "0x5a", "maxFeePerGas": "0x5a", "maxPriorityFeePerGas": "0xa"}
+		}
+	},
+	"queued": {
+		"0x0000000000000000000000000000000000000001": {
+			"3": {"gasPrice": "0x3e8"}
+		}
+	}
+}`
+
+func TestAddContent(t *testing.T) {
+	content := &txPoolContent{}
+	require.NoError(t, json.Unmarshal([]byte(txPoolContentFixture), content), "Error reading txpool_content fixture")
+	fan := map[common.Address]struct{}{common.HexToAddress("0x1"): {}}
+
+	tests := []struct {
+		name        string
+		baseFee     *big.Int
+		percentiles []float64
+		tips        []uint64
+	}{
+		{"effective tips at the base fee", big.NewInt(100), []float64{0, 50, 100}, []uint64{0, 20, 150}},
+		{"tip caps without a base fee", nil, []float64{0, 50, 100}, []uint64{10, 50, 250}},
+		{"no percentiles", big.NewInt(100), nil, nil},
+	}
+	for _, test := range tests {
+		snapshot := &MempoolSnapshot{}
+		snapshot.addContent(content, fan, test.baseFee, test.percentiles)
+		require.True(t, snapshot.ContentKnown, test.name)
+		require.Equal(t, uint64(2), snapshot.FanPending, test.name)
+		require.Equal(t, uint64(1), snapshot.FanQueued, test.name)
+		require.Equal(t, test.tips, snapshot.Tips, test.name)
+	}
+}
@@ -0,0 +1,73 @@
+package president
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Phase describes what the president is currently having the fans do
+type Phase string
+
+// Phases of a run
+const (
+	PhaseStarting   Phase = "starting"
+	PhaseRecruiting Phase = "recruiting"
+	PhaseFunding    Phase = "funding"
+	PhaseRunning    Phase = "running"
+	PhaseSpiking    Phase = "spiking"
+	PhasePaused     Phase = "paused"
+	PhaseStopping   Phase = "stopping"
+)
+
+var (
+	phaseMu      sync.RWMutex
+	currentPhase = PhaseStarting
+
+	paused atomic.Bool
+)
+
+// CurrentPhase returns what the fans are currently doing
+func CurrentPhase() Phase {
+	phaseMu.RLock()
+	phase := currentPhase
+	phaseMu.RUnlock()
+
+	if phase == PhaseRunning {
+		switch {
+		case Paused():
+			return PhasePaused
+		case Spiking():
+			return PhaseSpiking
+		}
+	}
+	return phase
+}
+
+// Pause stops fans from sending any new transactions. Blocks are still tracked, and fans keep confirming the
+// transactions they already have pending, so you can watch the chain recover.
+func Pause() {
+	if !paused.Swap(true) {
+		log.Info().Msg("Pausing fans")
+	}
+}
+
+// Resume lets fans start sending transactions again
+func Resume() {
+	if paused.Swap(false) {
+		log.Info().Msg("Resuming fans")
+	}
+}
+
+// Paused returns whether fans are paused
+func Paused() bool {
+	return paused.Load()
+}
+
+// SetPhase marks what the fans are now doing
+func SetPhase(phase Phase) {
+	phaseMu.Lock()
+	defer phaseMu.Unlock()
+	currentPhase = phase
+}
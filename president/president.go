@@ -2,12 +2,14 @@ package president
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/big"
-	"strings"
 	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/rs/zerolog/log"
@@ -16,226 +18,387 @@ import (
 	"github.com/kalverra/crazed-nft-fans/config"
 	"github.com/kalverra/crazed-nft-fans/convert"
 	"github.com/kalverra/crazed-nft-fans/fans"
+	"github.com/kalverra/crazed-nft-fans/throttle"
 )
 
-type TrackedBlock struct {
-	Hash     string `json:"hash"`
-	Number   uint64 `json:"number"`
-	GasPrice uint64 `json:"gasPrice"`
-	BaseFee  uint64 `json:"baseFee"`
-}
+// maxResubscribeBackoff is the longest the chain watcher waits between attempts to re-subscribe to new heads
+const maxResubscribeBackoff = 30 * time.Second
 
 var (
-	fanClub = []*fans.Fan{}
-	client  *ethclient.Client
+	fanClubMu sync.RWMutex
+	fanClub   = []*fans.Fan{}
+	everyFan  = []*fans.Fan{} // every fan that's joined the club this run, including dismissed ones, guarded by fanClubMu
+	client    *ethclient.Client
+	endpoints *fans.EndpointPool // Nodes fans send their transactions through, nil if they all use client
+	// rpcLimiter throttles the RPC calls made for every block, both the president's and the fans'
+	rpcLimiter *throttle.Limiter
 
-	trackedMu     sync.RWMutex
-	trackedBlocks = map[uint64]*TrackedBlock{}
+	watchers   sync.WaitGroup
+	runStarted time.Time
 
-	fundingNonceMu sync.Mutex
-	fundingNonce   uint64
+	fundingNonces *fans.Nonces // nonces for the funding address, handed out one funding transaction at a time
 
-	previousTargetGasPrice = big.NewInt(35000000000)
-	TargetGasPrice         = big.NewInt(35000000000) // 35 gwei, a common baseline
-	gasPriceIncrement      = big.NewInt(1000000000)  // 1 gwei
-	tempSpiked             = false
+	// staleBlockSends drops the last block's transactions still waiting on the RPC limits, used by the header loop only
+	staleBlockSends context.CancelFunc = func() {}
 )
 
-func WatchChain() error {
-	var err error
-	client, err = ethclient.Dial(config.Current.WS)
+// WatchChain connects to the chain and starts watching new blocks, having fans act on each one until ctx is done.
+// Use Wait to block until everything WatchChain started has stopped.
+func WatchChain(ctx context.Context) error {
+	err := OpenBlockHistory(config.Current.BlockHistorySize, config.Current.BlockHistoryFile)
+	if err != nil {
+		return err
+	}
+	err = SetGasTargetBand(config.Current.FloorGasPriceWei, config.Current.PeakGasPriceWei)
+	if err != nil {
+		return err
+	}
+	err = SetTransactionRate(fans.RateConfig{
+		Model: fans.RateModelName(config.Current.TxRateModel),
+		Rate:  config.Current.TxRate,
+	})
+	if err != nil {
+		return err
+	}
+	if err = SetSendMode(SendMode(config.Current.SendMode)); err != nil {
+		return err
+	}
+	rpcLimiter = throttle.New(config.Current.RPCRateLimit, config.Current.RPCBurst, config.Current.RPCMaxConcurrent)
+	fans.SetRPCLimiter(rpcLimiter)
+	client, err = ethclient.DialContext(ctx, config.Current.WS)
 	if err != nil {
 		return err
 	}
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return fmt.Errorf("error checking chain ID: %w", err)
+	}
+	if chainID.Cmp(config.Current.BigChainID) != 0 {
+		return fmt.Errorf("CHAIN_ID is %s, but the node at %s is on chain %s", config.Current.BigChainID, config.Current.WS, chainID)
+	}
+	if len(config.Current.FanRPCURLs) > 0 {
+		endpoints, err = fans.DialEndpoints(ctx, config.Current.FanRPCURLs, fans.EndpointMode(config.Current.FanRPCMode))
+		if err != nil {
+			return err
+		}
+		log.Info().Strs("URLs", config.Current.FanRPCURLs).Str("Mode", config.Current.FanRPCMode).Msg("Fans sending through endpoints")
+	}
+	fundingBalance, err := client.BalanceAt(ctx, config.Current.FundingAddress, nil)
+	if err != nil {
+		return fmt.Errorf("error checking funding balance: %w", err)
+	}
+	if err = checkSafety(chainID, fundingBalance); err != nil {
+		return err
+	}
 
-	fundingNonce, err = client.PendingNonceAt(context.Background(), config.Current.FundingAddress)
+	fundingNonces, err = fans.NewNonces(ctx, client, config.Current.FundingAddress)
 	if err != nil {
 		return err
 	}
 
 	newHeaderChan := make(chan *types.Header)
-	subscription, err := client.SubscribeNewHead(context.Background(), newHeaderChan)
+	subscription, err := client.SubscribeNewHead(ctx, newHeaderChan)
 	if err != nil {
 		return err
 	}
+	runStarted = time.Now()
+	runCtx = ctx
 
-	go func() {
+	goWatch(func() {
+		watchMempool(ctx, client.Client(), config.Current.MempoolPollInterval)
+	})
+	goWatch(func() {
+		defer func() { subscription.Unsubscribe() }()
 		for {
 			select {
+			case <-ctx.Done():
+				log.Info().Msg("Stopped watching chain")
+				return
 			case err := <-subscription.Err():
 				log.Error().Err(err).Msg("Error in subscription")
-
-				subscription, err = client.SubscribeNewHead(context.Background(), newHeaderChan)
-				if err != nil {
-					log.Error().Err(err).Msg("Error re-subscribing")
+				resubscribed, ok := resubscribe(ctx, newHeaderChan)
+				if !ok {
+					log.Info().Msg("Stopped watching chain")
+					return
 				}
+				subscription = resubscribed
 			case header := <-newHeaderChan:
-				gasPrice, err := client.SuggestGasPrice(context.Background())
-				if err != nil {
-					log.Error().Err(err).Uint64("Header", header.Number.Uint64()).Msg("Error getting gas price")
-					continue
-				}
-				percentBlockFilled := (float64(header.GasUsed) / float64(header.GasLimit)) * 100
-				gp, _ := convert.WeiToGwei(gasPrice).Float64()
-				tp, _ := convert.WeiToGwei(TargetGasPrice).Float64()
-				log.Info().
-					Str("Hash", header.Hash().Hex()).
-					Uint64("Number", header.Number.Uint64()).
-					Float64("Gas Price", gp).
-					Float64("Target Gas Price", tp).
-					Uint64("Base Fee", header.BaseFee.Uint64()).
-					Uint64("Gas Limit", header.GasLimit).
-					Uint64("Gas Used", header.GasUsed).
-					Str("Percent Block Filled", fmt.Sprintf("%.2f%%", percentBlockFilled)).
-					Msg("New block")
-				trackedBlock := &TrackedBlock{
-					Hash:     header.Hash().String(),
-					Number:   header.Number.Uint64(),
-					GasPrice: gasPrice.Uint64(),
-					BaseFee:  header.BaseFee.Uint64(),
-				}
-				TrackBlock(trackedBlock)
-				block, err := client.BlockByNumber(context.Background(), header.Number)
-				if err != nil {
-					log.Error().Err(err).Uint64("Header", header.Number.Uint64()).Msg("Error getting block")
-					continue
-				}
-				eg := errgroup.Group{}
-				for _, f := range fanClub {
-					fan := f
-					eg.Go(func() error {
-						return fan.ReceiveBlock(block, TargetGasPrice)
-					})
-				}
-				if err = eg.Wait(); err != nil {
-					if strings.Contains(err.Error(), "insufficient funds") {
-						log.Warn().Msg("Fans out of money, deploying capital!")
-						go func() {
-							err = FundFans(convert.EtherToWei(big.NewFloat(100)))
-							if err != nil {
-								log.Error().Err(err).Msg("Error funding fans, app is in a bad state")
-							}
-						}()
-					} else {
-						log.Error().Err(err).Uint64("Header", header.Number.Uint64()).Msg("Error receiving block")
-					}
-				}
-				if tempSpiked {
-					SetGasTarget(previousTargetGasPrice)
-					tempSpiked = false
-				}
+				receiveHeader(ctx, header)
 			}
 		}
-	}()
+	})
 
 	return nil
 }
 
-func AllBlocks() []*TrackedBlock {
-	trackedMu.RLock()
-	defer trackedMu.RUnlock()
+// resubscribe subscribes to new heads again after the subscription fails, backing off between attempts until it works
+// or ctx is done
+func resubscribe(ctx context.Context, headers chan<- *types.Header) (ethereum.Subscription, bool) {
+	backoff := time.Second
+	for {
+		subscription, err := client.SubscribeNewHead(ctx, headers)
+		if err == nil {
+			log.Info().Msg("Re-subscribed to new heads")
+			return subscription, true
+		}
+		log.Error().Err(err).Str("Retrying In", backoff.String()).Msg("Error re-subscribing")
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxResubscribeBackoff {
+			backoff = maxResubscribeBackoff
+		}
+	}
+}
 
-	blocks := []*TrackedBlock{}
-	validBlockFlag := false
-	for blockNum := 0; ; blockNum++ { // TODO: Save state of first block so we don't have to start from 0
-		if block, ok := trackedBlocks[uint64(blockNum)]; !ok {
-			if validBlockFlag { // end of valid blocks
-				break
-			}
+// Wait blocks until everything started by WatchChain has stopped
+func Wait() {
+	watchers.Wait()
+}
+
+// goWatch runs fn in a goroutine that Wait will wait on
+func goWatch(fn func()) {
+	watchers.Add(1)
+	go func() {
+		defer watchers.Done()
+		fn()
+	}()
+}
+
+// receiveHeader tracks a new block and has every fan act on it. Fans send in the background, so a slow or rate
+// limited node doesn't hold up the next block, which drops whatever the fans haven't sent for this one yet.
+func receiveHeader(ctx context.Context, header *types.Header) {
+	staleBlockSends()
+	gasPrice, err := throttle.Call(ctx, rpcLimiter, client.SuggestGasPrice)
+	if err != nil {
+		log.Error().Err(err).Uint64("Header", header.Number.Uint64()).Msg("Error getting gas price")
+		return
+	}
+	advanceReplay()
+	percentBlockFilled := (float64(header.GasUsed) / float64(header.GasLimit)) * 100
+	gp, _ := convert.WeiToGwei(gasPrice).Float64()
+	targetGasPrice := GasTarget()
+	tp, _ := convert.WeiToGwei(targetGasPrice).Float64()
+	log.Info().
+		Str("Hash", header.Hash().Hex()).
+		Uint64("Number", header.Number.Uint64()).
+		Float64("Gas Price", gp).
+		Float64("Target Gas Price", tp).
+		Uint64("Base Fee", header.BaseFee.Uint64()).
+		Uint64("Gas Limit", header.GasLimit).
+		Uint64("Gas Used", header.GasUsed).
+		Str("Percent Block Filled", fmt.Sprintf("%.2f%%", percentBlockFilled)).
+		Msg("New block")
+	block, err := throttle.Call(ctx, rpcLimiter, func(ctx context.Context) (*types.Block, error) {
+		return client.BlockByNumber(ctx, header.Number)
+	})
+	if err != nil {
+		log.Error().Err(err).Uint64("Header", header.Number.Uint64()).Msg("Error getting block")
+		return
+	}
+	addresses := fanAddresses()
+	trackedBlock := NewTrackedBlock(block, gasPrice, targetGasPrice, addresses)
+	if len(config.Current.FeeHistoryPercentiles) > 0 {
+		feeHistory, err := throttle.Call(ctx, rpcLimiter, func(ctx context.Context) (*ethereum.FeeHistory, error) {
+			return client.FeeHistory(ctx, 1, header.Number, config.Current.FeeHistoryPercentiles)
+		})
+		if err != nil {
+			log.Warn().Err(err).Uint64("Header", header.Number.Uint64()).Msg("Error getting fee history")
 		} else {
-			validBlockFlag = true
-			blocks = append(blocks, block)
+			trackedBlock.AddFeeHistory(feeHistory, config.Current.FeeHistoryPercentiles)
 		}
 	}
-	return blocks
-}
+	TrackBlock(trackedBlock)
+	accountBlock(ctx, client.Client(), block, addresses)
+	defer tickSpike()
+	defer refundLowFans(ctx)
 
-func BlocksSinceNumber(number uint64) []*TrackedBlock {
-	trackedMu.RLock()
-	defer trackedMu.RUnlock()
-	number++
-	blocks := []*TrackedBlock{}
-	for block, ok := trackedBlocks[number]; ok; number++ {
-		blocks = append(blocks, block)
+	timerMode := CurrentSendMode() == SendOnTimer
+	syncTimerSenders(ctx, timerMode)
+	if Paused() || timerMode {
+		for _, fan := range listeningFans() {
+			fan.ConfirmBlock(block)
+		}
+		updateMarket(block, targetGasPrice)
+		return
 	}
-	return blocks
-}
 
-// TrackBlock adds another block to our tracked group
-func TrackBlock(block *TrackedBlock) {
-	trackedMu.Lock()
-	defer trackedMu.Unlock()
+	blockCtx, cancel := context.WithCancel(ctx)
+	staleBlockSends = cancel
+	eg := errgroup.Group{}
+	rate, sending := currentRateModel(), sendingFanCount()
+	for _, f := range listeningFans() {
+		fan, txCount := f, rate.TransactionsPerBlock(block.GasLimit(), sending)
+		eg.Go(func() error {
+			return fan.ReceiveBlock(ctx, blockCtx, block, targetGasPrice, txCount)
+		})
+	}
+	goWatch(func() {
+		if err := eg.Wait(); err != nil {
+			handleFanError(ctx, err)
+		}
+	})
+}
 
-	trackedBlocks[block.Number] = block
+// handleFanError reacts to an error from a fan sending transactions
+func handleFanError(ctx context.Context, err error) {
+	switch {
+	case ctx.Err() != nil:
+		return
+	case errors.Is(err, fans.ErrInsufficientBalance):
+		// The fan stops sending until it's topped up, which refundLowFans takes care of every block
+		log.Debug().Err(err).Msg("Fan out of money")
+	case errors.Is(err, fans.ErrNonceTooLow), errors.Is(err, fans.ErrReplacementUnderpriced):
+		// The fan has already synced its nonce with the node, and carries on next time
+		log.Debug().Err(err).Msg("Fan's nonce was out of sync")
+	case errors.Is(err, fans.ErrFeeCapTooLow):
+		// The base fee moved past the fan's fee cap, the next block's base fee will catch it up
+		log.Debug().Err(err).Msg("Fan's fee cap fell behind the base fee")
+	case errors.Is(err, fans.ErrTxPoolFull):
+		log.Warn().Err(err).Msg("Node's transaction pool is full, fans can't send any more until it drains")
+	case errors.Is(err, fans.ErrTimeout):
+		log.Warn().Err(err).Msg("Timed out sending transactions")
+	default:
+		log.Error().Err(err).Msg("Error sending transactions")
+	}
 }
 
-func FundFans(wei *big.Int) error {
-	log.Info().Str("Wei", wei.String()).Int("Count", len(fanClub)).Msg("Funding fans")
+// FundFans sends wei to every fan in the club from the funding key
+func FundFans(ctx context.Context, wei *big.Int) error {
+	club := Fans()
+	log.Info().Str("Wei", wei.String()).Int("Count", len(club)).Msg("Funding fans")
 	eg := errgroup.Group{}
-	for _, f := range fanClub {
+	for _, f := range club {
 		fan := f
 		eg.Go(func() error {
-			return fan.Fund(wei, FundingNonce(), time.Minute)
+			err := fundFan(ctx, fan, wei)
+			if errors.Is(err, ErrFundingInFlight) {
+				return nil
+			}
+			return err
 		})
 	}
 	if err := eg.Wait(); err != nil {
 		return err
 	}
-	log.Info().Str("Wei", wei.String()).Int("Count", len(fanClub)).Msg("Funded fans")
+	log.Info().Str("Wei", wei.String()).Int("Count", len(club)).Msg("Funded fans")
 	return nil
 }
 
-func RecruitFans(count int) error {
+// RecruitFans adds count new fans to the club
+func RecruitFans(ctx context.Context, count int) error {
 	for i := 0; i < count; i++ {
-		fan, err := fans.New(client)
+		fan, err := recruitFan(ctx)
 		if err != nil {
 			return err
 		}
-		fanClub = append(fanClub, fan)
+		joinClub(fan)
 	}
 	log.Info().Int("Count", count).Msg("Recruited fans")
 	return nil
 }
 
-func FundingNonce() uint64 {
-	fundingNonceMu.Lock()
-	defer fundingNonceMu.Unlock()
-	n := fundingNonce
-	fundingNonce++
-	return n
+// SweepFans retires every fan in the club and sends whatever they have left back to the funding address
+func SweepFans(ctx context.Context) error {
+	club := Fans()
+	log.Info().Int("Count", len(club)).Msg("Sweeping fans")
+	eg := errgroup.Group{}
+	for _, f := range club {
+		fan := f
+		fan.Retire()
+		eg.Go(func() error {
+			return fan.Sweep(ctx, config.Current.FundingAddress, time.Minute)
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+	log.Info().Int("Count", len(club)).Msg("Swept fans")
+	return nil
+}
+
+// useEndpoints has a fan send its transactions through the fan RPC endpoints, if there are any
+func useEndpoints(fan *fans.Fan) {
+	if endpoints != nil {
+		fan.UseEndpoints(endpoints)
+	}
+}
+
+// EndpointStats returns how the transactions sent through each fan RPC endpoint have fared, nil if fans all send
+// through the one node
+func EndpointStats() []fans.EndpointStats {
+	if endpoints == nil {
+		return nil
+	}
+	return endpoints.Stats()
 }
 
-func SetGasTarget(gasPrice *big.Int) {
-	previousTargetGasPrice = TargetGasPrice
-	TargetGasPrice = gasPrice
+// CloseEndpoints disconnects from the fan RPC endpoints, if there are any. Call it once everything WatchChain started
+// has stopped.
+func CloseEndpoints() {
+	if endpoints != nil {
+		endpoints.Close()
+	}
 }
 
-func IncreaseGasTarget() *big.Int {
-	newLevel := big.NewInt(0).Add(TargetGasPrice, gasPriceIncrement)
-	SetGasTarget(newLevel)
-	return newLevel
+// RPCThrottling returns how much the RPC calls made for each block have been held back
+func RPCThrottling() throttle.Stats {
+	return rpcLimiter.Stats()
 }
 
-func DecreaseGasTarget() *big.Int {
-	newLevel := big.NewInt(0).Sub(TargetGasPrice, gasPriceIncrement)
-	SetGasTarget(newLevel)
-	return newLevel
+// Fans returns a snapshot of everyone in the fan club
+func Fans() []*fans.Fan {
+	fanClubMu.RLock()
+	defer fanClubMu.RUnlock()
+	return append([]*fans.Fan{}, fanClub...)
 }
 
-func TempSpike() *big.Int {
-	newLevel := big.NewInt(0).Mul(TargetGasPrice, big.NewInt(100))
-	SetGasTarget(newLevel)
-	log.Info().
-		Uint64("New Level", newLevel.Uint64()).
-		Uint64("Old Level", TargetGasPrice.Uint64()).
-		Msg("Temporarily Spiking Gas Price")
-	tempSpiked = true
-	return newLevel
-}
-
-func PermanentSpike() *big.Int {
-	log.Info().Msg("Permanently Spiking Gas Price")
-	newLevel := big.NewInt(0).Mul(TargetGasPrice, big.NewInt(100))
-	SetGasTarget(newLevel)
-	return newLevel
+// AllFans returns every fan that's been in the club this run, including ones that have since been dismissed
+func AllFans() []*fans.Fan {
+	fanClubMu.RLock()
+	defer fanClubMu.RUnlock()
+	return append([]*fans.Fan{}, everyFan...)
+}
+
+// joinClub adds a fan to the club
+func joinClub(fan *fans.Fan) {
+	fanClubMu.Lock()
+	defer fanClubMu.Unlock()
+	fanClub = append(fanClub, fan)
+	everyFan = append(everyFan, fan)
+}
+
+// listeningFans returns everyone that needs to see new blocks, the fan club plus fans that are still retiring
+func listeningFans() []*fans.Fan {
+	fanClubMu.RLock()
+	defer fanClubMu.RUnlock()
+	listening := append([]*fans.Fan{}, fanClub...)
+	for fan := range retiringFans {
+		listening = append(listening, fan)
+	}
+	return listening
+}
+
+// sendingFanCount counts the fans that will actually send for the next block, the funded ones still in the club, so
+// rate models that share a block out between fans give each their full share
+func sendingFanCount() int {
+	count := 0
+	for _, fan := range Fans() {
+		if fan.Funded() && !fan.Retired() {
+			count++
+		}
+	}
+	return count
+}
+
+// fanAddresses returns the set of all addresses in the fan club, including retiring fans
+func fanAddresses() map[common.Address]struct{} {
+	club := listeningFans()
+	addresses := make(map[common.Address]struct{}, len(club))
+	for _, fan := range club {
+		addresses[*fan.Address] = struct{}{}
+	}
+	return addresses
 }
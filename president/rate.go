@@ -0,0 +1,42 @@
+package president
+
+import (
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/kalverra/crazed-nft-fans/fans"
+)
+
+var (
+	rateMu     sync.RWMutex
+	rateConfig = fans.RateConfig{Model: fans.RateUniform, Rate: 20}
+	rateModel  = fans.RateModel(&fans.UniformRate{Max: 20})
+)
+
+// TransactionRate returns how fans are deciding how many transactions to send each block
+func TransactionRate() fans.RateConfig {
+	rateMu.RLock()
+	defer rateMu.RUnlock()
+	return rateConfig
+}
+
+// SetTransactionRate changes how many transactions fans send each block
+func SetTransactionRate(newConfig fans.RateConfig) error {
+	model, err := fans.NewRateModel(newConfig)
+	if err != nil {
+		return err
+	}
+	rateMu.Lock()
+	defer rateMu.Unlock()
+	rateConfig, rateModel = newConfig, model
+	log.Info().Str("Model", string(newConfig.Model)).Float64("Rate", newConfig.Rate).Msg("Set transaction rate")
+	return nil
+}
+
+// currentRateModel returns the model deciding how many transactions each fan sends per block
+func currentRateModel() fans.RateModel {
+	rateMu.RLock()
+	defer rateMu.RUnlock()
+	return rateModel
+}
@@ -0,0 +1,108 @@
+package president
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/kalverra/crazed-nft-fans/config"
+	"github.com/kalverra/crazed-nft-fans/fans"
+)
+
+// ErrFundingInFlight is returned when a fan is already waiting on funding, so it isn't funded twice
+var ErrFundingInFlight = errors.New("fan is already being funded")
+
+var (
+	fundingMu       sync.Mutex
+	fundingInFlight = map[*fans.Fan]struct{}{}
+)
+
+// fundFan sends wei to a fan from the funding key, as long as it stays within the spend cap and the fan isn't
+// already being funded. The fan counts as being funded until its funding confirms or the node drops it.
+func fundFan(ctx context.Context, fan *fans.Fan, wei *big.Int) error {
+	fundingMu.Lock()
+	if _, inFlight := fundingInFlight[fan]; inFlight {
+		fundingMu.Unlock()
+		return ErrFundingInFlight
+	}
+	fundingInFlight[fan] = struct{}{}
+	fundingMu.Unlock()
+	defer func() {
+		fundingMu.Lock()
+		delete(fundingInFlight, fan)
+		fundingMu.Unlock()
+	}()
+
+	if err := reserveFunding(wei); err != nil {
+		return err
+	}
+	return fan.Fund(ctx, wei, fundingNonces, time.Minute)
+}
+
+// refundLowFans tops up every fan that's run out, or is about to, in the background. Fans are only refunded while
+// running, so they don't race their initial funding.
+func refundLowFans(ctx context.Context) {
+	if phase := CurrentPhase(); ctx.Err() != nil || (phase != PhaseRunning && phase != PhaseSpiking) {
+		return
+	}
+	for _, f := range Fans() {
+		fan := f
+		if fan.Retired() {
+			continue
+		}
+		rate, balance := fan.SpendRate(), fan.Balance()
+		threshold := refundThreshold(rate)
+		if fan.Funded() && balance.Cmp(threshold) >= 0 {
+			continue
+		}
+		amount := topUpAmount(rate, threshold)
+		goWatch(func() {
+			err := fundFan(ctx, fan, amount)
+			switch {
+			case err == nil:
+				log.Debug().
+					Str("Fan", fan.Address.Hex()).
+					Str("Balance", balance.String()).
+					Str("Spend Rate", rate.String()).
+					Str("Wei", amount.String()).
+					Msg("Topped up fan")
+			case errors.Is(err, ErrFundingInFlight), ctx.Err() != nil:
+			case errors.Is(err, ErrSpendCapReached):
+				log.Debug().Err(err).Str("Fan", fan.Address.Hex()).Msg("Can't top up fan")
+			default:
+				log.Error().Err(err).Str("Fan", fan.Address.Hex()).Msg("Error topping up fan")
+			}
+		})
+	}
+}
+
+// refundThreshold is how low the balance of a fan spending rate wei per block can get before it's topped up. That's
+// enough for REFUND_LEAD_BLOCKS more blocks, and never below REFUND_THRESHOLD.
+func refundThreshold(rate *big.Int) *big.Int {
+	threshold := new(big.Int).Mul(rate, big.NewInt(int64(config.Current.RefundLeadBlocks)))
+	if threshold.Cmp(config.Current.RefundThresholdWei) < 0 {
+		threshold.Set(config.Current.RefundThresholdWei)
+	}
+	return threshold
+}
+
+// topUpAmount is how much to send a fan spending rate wei per block, enough for REFUND_TOPUP_BLOCKS more blocks.
+// It's at least the fan's threshold, so a top up lifts it back over, and at most FUND_AMOUNT. Fans that haven't
+// spent anything yet get FUND_AMOUNT.
+func topUpAmount(rate, threshold *big.Int) *big.Int {
+	if rate.Sign() == 0 {
+		return new(big.Int).Set(config.Current.FundAmountWei)
+	}
+	amount := new(big.Int).Mul(rate, big.NewInt(int64(config.Current.RefundTopUpBlocks)))
+	if amount.Cmp(threshold) < 0 {
+		amount.Set(threshold)
+	}
+	if amount.Cmp(config.Current.FundAmountWei) > 0 {
+		amount.Set(config.Current.FundAmountWei)
+	}
+	return amount
+}
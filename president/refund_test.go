@@ -0,0 +1,54 @@
+package president
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kalverra/crazed-nft-fans/config"
+	"github.com/kalverra/crazed-nft-fans/fans"
+)
+
+func TestTopUps(t *testing.T) {
+	useConfig(t, &config.Config{
+		RefundThresholdWei: big.NewInt(1000),
+		RefundLeadBlocks:   5,
+		RefundTopUpBlocks:  50,
+		FundAmountWei:      big.NewInt(100_000),
+	})
+
+	tests := []struct {
+		name                   string
+		rate, threshold, topUp int64
+	}{
+		{"hasn't spent yet", 0, 1000, 100_000},
+		{"slow spender", 10, 1000, 1000},
+		{"steady spender", 100, 1000, 5000},
+		{"fast spender", 1000, 5000, 50_000},
+		{"very fast spender", 10_000, 50_000, 100_000},
+	}
+	for _, test := range tests {
+		rate := big.NewInt(test.rate)
+		threshold := refundThreshold(rate)
+		require.Equal(t, test.threshold, threshold.Int64(), "%s threshold", test.name)
+		require.Equal(t, test.topUp, topUpAmount(rate, threshold).Int64(), "%s top up", test.name)
+	}
+}
+
+func TestFundFanInFlight(t *testing.T) {
+	fan := &fans.Fan{}
+	fundingMu.Lock()
+	fundingInFlight[fan] = struct{}{}
+	fundingMu.Unlock()
+	t.Cleanup(func() {
+		fundingMu.Lock()
+		delete(fundingInFlight, fan)
+		fundingMu.Unlock()
+	})
+
+	require.ErrorIs(t, fundFan(context.Background(), fan, big.NewInt(1)), ErrFundingInFlight,
+		"A fan should only have one funding in flight")
+	require.Zero(t, FundingSent().Sign(), "Refused funding shouldn't count towards the spend cap")
+}
@@ -0,0 +1,93 @@
+package president
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/kalverra/crazed-nft-fans/convert"
+)
+
+// replayColumn is the column of historical data that replays aim for, as in analysis/crypto_kitties_*.csv
+const replayColumn = "average_gwei_paid"
+
+var (
+	replayMu      sync.Mutex
+	replayTargets []*big.Int
+	replayDone    chan struct{}
+)
+
+// LoadReplay reads the average gas price paid in each block of historical data, like the CSVs in the analysis
+// folder or the blocks from an export
+func LoadReplay(path string) ([]*big.Int, error) {
+	file, err := os.Open(path) // #nosec G304 - path is operator supplied
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%s is empty", path)
+	}
+	column := -1
+	for i, name := range rows[0] {
+		if name == replayColumn {
+			column = i
+		}
+	}
+	if column < 0 {
+		return nil, fmt.Errorf("%s has no %s column", path, replayColumn)
+	}
+
+	targets := make([]*big.Int, 0, len(rows)-1)
+	for i, row := range rows[1:] {
+		gwei, err := strconv.ParseFloat(row[column], 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad %s on line %d of %s: %w", replayColumn, i+2, path, err)
+		}
+		if gwei <= 0 {
+			return nil, fmt.Errorf("%s on line %d of %s must be positive, got %f", replayColumn, i+2, path, gwei)
+		}
+		targets = append(targets, convert.GweiToWei(big.NewFloat(gwei)))
+	}
+	return targets, nil
+}
+
+// Replay sets the target gas price to each of targets in turn, one per block. The returned channel closes once
+// every target has been used.
+func Replay(targets []*big.Int) <-chan struct{} {
+	replayMu.Lock()
+	defer replayMu.Unlock()
+
+	replayTargets = targets
+	replayDone = make(chan struct{})
+	log.Info().Int("Blocks", len(targets)).Msg("Replaying gas prices")
+	return replayDone
+}
+
+// advanceReplay moves the target gas price on to the next block of the replay, if one is running
+func advanceReplay() {
+	replayMu.Lock()
+	defer replayMu.Unlock()
+
+	if replayDone == nil {
+		return
+	}
+	if len(replayTargets) == 0 {
+		log.Info().Msg("Finished replay")
+		close(replayDone)
+		replayDone = nil
+		return
+	}
+	SetGasTarget(replayTargets[0])
+	replayTargets = replayTargets[1:]
+}
@@ -0,0 +1,168 @@
+package president
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/kalverra/crazed-nft-fans/config"
+	"github.com/kalverra/crazed-nft-fans/fans"
+)
+
+// drainTimeout is how long a dismissed fan gets to confirm its pending transactions before it's swept anyway
+const drainTimeout = 2 * time.Minute
+
+var (
+	runCtx = context.Background() // lives as long as the run, for work that outlives the request that started it
+
+	scaleMu      sync.Mutex
+	queued       int                        // fans waiting to be recruited in the background, guarded by scaleMu
+	joining      int                        // fans being recruited right now, guarded by scaleMu
+	retiringFans = map[*fans.Fan]struct{}{} // dismissed fans still confirming transactions, guarded by fanClubMu
+)
+
+// Population describes how many fans there are, and how many are on their way in or out
+type Population struct {
+	Fans       int `json:"fans"`
+	Funded     int `json:"funded"`
+	Recruiting int `json:"recruiting"`
+	Retiring   int `json:"retiring"`
+}
+
+// FanPopulation counts the fan club
+func FanPopulation() *Population {
+	scaleMu.Lock()
+	population := &Population{Recruiting: queued + joining}
+	scaleMu.Unlock()
+
+	club := Fans()
+	population.Fans = len(club)
+	for _, fan := range club {
+		if fan.Funded() {
+			population.Funded++
+		}
+	}
+	fanClubMu.RLock()
+	population.Retiring = len(retiringFans)
+	fanClubMu.RUnlock()
+	return population
+}
+
+// ScaleFans grows or shrinks the fan club to count fans. New fans are recruited and funded in the background.
+// Dismissed fans stop sending right away, then wait for their pending transactions to confirm and sweep what they
+// have left back to the funding address in the background.
+func ScaleFans(count int) error {
+	if count < 0 {
+		return fmt.Errorf("can't have %d fans", count)
+	}
+	scaleMu.Lock()
+	defer scaleMu.Unlock()
+
+	current := len(Fans()) + queued + joining
+	switch {
+	case count > current:
+		toRecruit := count - current
+		queued += toRecruit
+		log.Info().Int("Count", toRecruit).Int("Target", count).Msg("Recruiting more fans")
+		goWatch(func() { recruitAndFund(runCtx, toRecruit) })
+	case count < current:
+		dismissFans(current - count)
+	}
+	return nil
+}
+
+// recruitAndFund brings up to count new fans into the club one at a time, funding each as it joins. It stops early
+// once the queue is empty, which is how fans that were called off before joining are left out.
+func recruitAndFund(ctx context.Context, count int) {
+	for i := 0; i < count; i++ {
+		scaleMu.Lock()
+		if queued == 0 {
+			scaleMu.Unlock()
+			return
+		}
+		queued--
+		joining++
+		scaleMu.Unlock()
+
+		fan, err := recruitFan(ctx)
+		scaleMu.Lock()
+		joining--
+		if err == nil {
+			// Fans need to be in the club to see their funding confirm. They join before scaleMu is released, so
+			// they're always counted either as joining or in the club.
+			joinClub(fan)
+		}
+		scaleMu.Unlock()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Error().Err(err).Msg("Error recruiting fan")
+			}
+			continue
+		}
+
+		// Once in the club, the fan can be topped up before it gets here, which funds it just the same
+		err = fundFan(ctx, fan, config.Current.FundAmountWei)
+		switch {
+		case errors.Is(err, ErrFundingInFlight):
+		case errors.Is(err, ErrSpendCapReached):
+			log.Warn().Err(err).Str("Fan", fan.Address.Hex()).Msg("Spend cap reached, new fan won't be funded")
+		case err != nil && ctx.Err() == nil:
+			log.Error().Err(err).Str("Fan", fan.Address.Hex()).Msg("Error funding new fan")
+		}
+	}
+}
+
+// dismissFans retires the count most recently recruited fans, and sends them off to sweep their funds.
+// Fans still waiting to be recruited are called off first. Fans being recruited right now are left to join, and may
+// be dismissed by a later scale down. The caller must hold scaleMu.
+func dismissFans(count int) {
+	calledOff := count
+	if calledOff > queued {
+		calledOff = queued
+	}
+	queued -= calledOff
+	count -= calledOff
+
+	fanClubMu.Lock()
+	if count > len(fanClub) {
+		count = len(fanClub)
+	}
+	dismissed := fanClub[len(fanClub)-count:]
+	fanClub = append([]*fans.Fan{}, fanClub[:len(fanClub)-count]...)
+	for _, fan := range dismissed {
+		retiringFans[fan] = struct{}{}
+	}
+	fanClubMu.Unlock()
+
+	log.Info().Int("Count", len(dismissed)).Msg("Dismissing fans")
+	for _, f := range dismissed {
+		fan := f
+		fan.Retire()
+		goWatch(func() { sweepFan(runCtx, fan) })
+	}
+}
+
+// sweepFan waits for a retired fan's transactions to confirm, then sends its funds back to the funding address
+func sweepFan(ctx context.Context, fan *fans.Fan) {
+	defer func() {
+		fanClubMu.Lock()
+		delete(retiringFans, fan)
+		fanClubMu.Unlock()
+	}()
+
+	if err := fan.Drain(ctx, drainTimeout); err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		log.Warn().Err(err).Str("Fan", fan.Address.Hex()).Msg("Fan didn't drain, sweeping anyway")
+	}
+	if err := fan.Sweep(ctx, config.Current.FundingAddress, time.Minute); err != nil && ctx.Err() == nil {
+		log.Error().Err(err).Str("Fan", fan.Address.Hex()).Msg("Error sweeping fan")
+		return
+	}
+	log.Debug().Str("Fan", fan.Address.Hex()).Msg("Fan dismissed")
+}
@@ -0,0 +1,63 @@
+package president
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kalverra/crazed-nft-fans/config"
+	"github.com/kalverra/crazed-nft-fans/fans"
+)
+
+// slowNode hands out nonces for new fans, but only once it's let go
+type slowNode struct {
+	letGo chan struct{}
+}
+
+func (n *slowNode) GetTransactionCount(common.Address, string) (hexutil.Uint64, error) {
+	<-n.letGo
+	return 0, nil
+}
+
+func TestScaleDownWhileRecruiting(t *testing.T) {
+	// A spend cap of 1 wei refuses funding, so new fans join without sending anything
+	useConfig(t, &config.Config{FundAmountWei: big.NewInt(100), SpendCapWei: big.NewInt(1)})
+	node := &slowNode{letGo: make(chan struct{})}
+	server := rpc.NewServer()
+	require.NoError(t, server.RegisterName("eth", node))
+	t.Cleanup(server.Stop)
+
+	previousClient := client
+	client = ethclient.NewClient(rpc.DialInProc(server))
+	t.Cleanup(func() {
+		client = previousClient
+		fanClubMu.Lock()
+		fanClub, everyFan = []*fans.Fan{}, []*fans.Fan{}
+		fanClubMu.Unlock()
+	})
+
+	require.NoError(t, ScaleFans(10))
+	require.Equal(t, 10, FanPopulation().Recruiting)
+	require.NoError(t, ScaleFans(4), "Scaling down should call off fans still waiting to be recruited")
+	require.Equal(t, 4, FanPopulation().Recruiting)
+
+	close(node.letGo)
+	require.Eventually(t, func() bool {
+		population := FanPopulation()
+		return population.Recruiting == 0 && population.Fans == 4
+	}, 5*time.Second, 10*time.Millisecond, "Called off fans shouldn't join the club")
+	Wait()
+	require.Equal(t, &Population{Fans: 4}, FanPopulation())
+	require.Len(t, AllFans(), 4, "Fans that were called off shouldn't count as having been in the club")
+
+	fanClubMu.Lock()
+	fanClub = fanClub[:2] // As if the other 2 had been dismissed
+	fanClubMu.Unlock()
+	require.Len(t, AllFans(), 4, "Dismissed fans should still be exported")
+}
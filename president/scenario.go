@@ -0,0 +1,187 @@
+package president
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/kalverra/crazed-nft-fans/convert"
+	"github.com/kalverra/crazed-nft-fans/fans"
+)
+
+// Duration is a time.Duration written as a string like "30s" in scenario files
+type Duration time.Duration
+
+// UnmarshalJSON reads a duration string
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("durations must be strings like \"30s\": %w", err)
+	}
+	duration, err := time.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+// MarshalJSON writes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Scenario is a scripted run, a list of steps applied one after another
+type Scenario struct {
+	Name  string         `json:"name"`
+	Steps []ScenarioStep `json:"steps"`
+}
+
+// ScenarioStep waits, then changes whichever settings it has set
+type ScenarioStep struct {
+	Name       string           `json:"name,omitempty"`
+	Wait       Duration         `json:"wait,omitempty"` // How long to wait after the previous step
+	TargetGwei *float64         `json:"targetGwei,omitempty"`
+	Spike      *ScenarioSpike   `json:"spike,omitempty"`
+	Rate       *fans.RateConfig `json:"rate,omitempty"`
+	SendMode   SendMode         `json:"sendMode,omitempty"`
+	Fans       *int             `json:"fans,omitempty"`
+	Pause      *bool            `json:"pause,omitempty"`
+}
+
+// ScenarioSpike is a spike in a scenario, lasting for DurationBlocks or Duration
+type ScenarioSpike struct {
+	Multiplier     float64  `json:"multiplier"`
+	DurationBlocks uint64   `json:"durationBlocks,omitempty"`
+	Duration       Duration `json:"duration,omitempty"`
+	Decay          Decay    `json:"decay,omitempty"`
+}
+
+// config converts the scenario spike to the spike it describes, decaying instantly by default
+func (s *ScenarioSpike) config() SpikeConfig {
+	spike := SpikeConfig{
+		Multiplier:     s.Multiplier,
+		DurationBlocks: s.DurationBlocks,
+		Duration:       time.Duration(s.Duration),
+		Decay:          s.Decay,
+	}
+	if spike.Decay == "" {
+		spike.Decay = DecayInstant
+	}
+	return spike
+}
+
+// LoadScenario reads and checks a JSON scenario file
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path) // #nosec G304 - path is operator supplied
+	if err != nil {
+		return nil, err
+	}
+	scenario := &Scenario{}
+	if err = json.Unmarshal(data, scenario); err != nil {
+		return nil, fmt.Errorf("error reading scenario %s: %w", path, err)
+	}
+	if err = scenario.Validate(); err != nil {
+		return nil, fmt.Errorf("bad scenario %s: %w", path, err)
+	}
+	return scenario, nil
+}
+
+// Validate checks every step of the scenario before any of it runs
+func (s *Scenario) Validate() error {
+	if len(s.Steps) == 0 {
+		return errors.New("scenario has no steps")
+	}
+	for i, step := range s.Steps {
+		if err := step.validate(); err != nil {
+			return fmt.Errorf("step %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (s *ScenarioStep) validate() error {
+	if s.Wait < 0 {
+		return fmt.Errorf("wait can't be negative, got %s", time.Duration(s.Wait))
+	}
+	if s.TargetGwei != nil && *s.TargetGwei <= 0 {
+		return fmt.Errorf("targetGwei must be greater than 0, got %f", *s.TargetGwei)
+	}
+	if s.Spike != nil {
+		spike := s.Spike.config()
+		if err := spike.Validate(); err != nil {
+			return err
+		}
+	}
+	if s.Rate != nil {
+		if _, err := fans.NewRateModel(*s.Rate); err != nil {
+			return err
+		}
+	}
+	if s.SendMode != "" {
+		if err := s.SendMode.Validate(); err != nil {
+			return err
+		}
+	}
+	if s.Fans != nil && *s.Fans < 0 {
+		return fmt.Errorf("can't have %d fans", *s.Fans)
+	}
+	return nil
+}
+
+// Run works through each step of the scenario, returning once the last step is applied or ctx is done
+func (s *Scenario) Run(ctx context.Context) error {
+	log.Info().Str("Scenario", s.Name).Int("Steps", len(s.Steps)).Msg("Starting scenario")
+	for i, step := range s.Steps {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(step.Wait)):
+		}
+		log.Info().Str("Scenario", s.Name).Int("Step", i+1).Str("Name", step.Name).Msg("Scenario step")
+		if err := step.apply(); err != nil {
+			return fmt.Errorf("step %d: %w", i+1, err)
+		}
+	}
+	log.Info().Str("Scenario", s.Name).Msg("Finished scenario")
+	return nil
+}
+
+// apply makes the changes the step describes
+func (s *ScenarioStep) apply() error {
+	if s.Pause != nil {
+		if *s.Pause {
+			Pause()
+		} else {
+			Resume()
+		}
+	}
+	if s.TargetGwei != nil {
+		SetGasTarget(convert.GweiToWei(big.NewFloat(*s.TargetGwei)))
+	}
+	if s.Spike != nil {
+		if _, err := Spike(s.Spike.config()); err != nil {
+			return err
+		}
+	}
+	if s.Rate != nil {
+		if err := SetTransactionRate(*s.Rate); err != nil {
+			return err
+		}
+	}
+	if s.SendMode != "" {
+		if err := SetSendMode(s.SendMode); err != nil {
+			return err
+		}
+	}
+	if s.Fans != nil {
+		return ScaleFans(*s.Fans)
+	}
+	return nil
+}
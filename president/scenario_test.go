@@ -0,0 +1,59 @@
+package president_test
+
+import (
+	"context"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kalverra/crazed-nft-fans/president"
+)
+
+func writeFile(t *testing.T, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0600), "Error writing test file")
+	return path
+}
+
+func TestLoadReplay(t *testing.T) {
+	path := writeFile(t, "replay.csv", "block_number,average_gwei_paid\n4.687867e+06,26.5\n4.687868e+06,79.25\n")
+	targets, err := president.LoadReplay(path)
+	require.NoError(t, err, "Error loading replay")
+	require.Equal(t, []*big.Int{big.NewInt(26_500_000_000), big.NewInt(79_250_000_000)}, targets)
+
+	_, err = president.LoadReplay(writeFile(t, "bad.csv", "block_number,gas\n1,2\n"))
+	require.Error(t, err, "Replay without an average_gwei_paid column should error")
+}
+
+func TestScenario(t *testing.T) {
+	t.Cleanup(func() {
+		president.ClearSpikes()
+		president.Resume()
+	})
+	path := writeFile(t, "scenario.json", `{
+		"name": "test",
+		"steps": [
+			{"name": "calm", "targetGwei": 20, "pause": true},
+			{"wait": "10ms", "spike": {"multiplier": 3, "durationBlocks": 2}}
+		]
+	}`)
+	scenario, err := president.LoadScenario(path)
+	require.NoError(t, err, "Error loading scenario")
+	require.Equal(t, president.Duration(10*time.Millisecond), scenario.Steps[1].Wait)
+
+	require.NoError(t, scenario.Run(context.Background()), "Error running scenario")
+	require.True(t, president.Paused())
+	require.Equal(t, big.NewInt(20_000_000_000), president.BaseGasTarget())
+	require.Equal(t, big.NewInt(60_000_000_000), president.GasTarget())
+
+	_, err = president.LoadScenario(writeFile(t, "bad.json", `{"steps": [{"sendMode": "whenever"}]}`))
+	require.Error(t, err, "Scenario with a bad send mode should error before running")
+
+	_, err = president.LoadScenario(filepath.Join("..", "scenarios", "congestion.json"))
+	require.NoError(t, err, "Example scenario should load")
+}
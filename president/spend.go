@@ -0,0 +1,216 @@
+package president
+
+import (
+	"context"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/rs/zerolog/log"
+
+	"github.com/kalverra/crazed-nft-fans/config"
+	"github.com/kalverra/crazed-nft-fans/convert"
+)
+
+// Spend accounts for where the run's ETH has gone, in wei
+type Spend struct {
+	FundedWei             string  `json:"fundedWei"`             // Sent to fans from the funding address
+	GasSpentWei           string  `json:"gasSpentWei"`           // Paid for gas by the fans, and by the funder funding them
+	ValueSentWei          string  `json:"valueSentWei"`          // Sent by fans to random addresses
+	SweptWei              string  `json:"sweptWei"`              // Swept back to the funding address by dismissed fans
+	EstimatedRemainingWei string  `json:"estimatedRemainingWei"` // Left with the fans by the above, not their balances
+	TotalSpentWei         string  `json:"totalSpentWei"`         // Gone for good, gas spent plus value sent
+	TotalSpentEther       float64 `json:"totalSpentEther"`       // TotalSpentWei in ETH, for people
+	BudgetEther           float64 `json:"budgetEther,omitempty"`
+	BudgetExhausted       bool    `json:"budgetExhausted"`
+}
+
+// spendTally is the running total of a run's spend, or of a single block's
+type spendTally struct {
+	funded, fundingGas, fanGas, valueSent, swept *big.Int
+}
+
+var (
+	runSpendMu      sync.Mutex
+	runSpend        = newSpendTally() // what the fans and funder have spent this run, by the receipts in each block
+	budgetExhausted bool
+)
+
+func newSpendTally() *spendTally {
+	return &spendTally{
+		funded:     big.NewInt(0),
+		fundingGas: big.NewInt(0),
+		fanGas:     big.NewInt(0),
+		valueSent:  big.NewInt(0),
+		swept:      big.NewInt(0),
+	}
+}
+
+func (s *spendTally) add(other *spendTally) {
+	s.funded.Add(s.funded, other.funded)
+	s.fundingGas.Add(s.fundingGas, other.fundingGas)
+	s.fanGas.Add(s.fanGas, other.fanGas)
+	s.valueSent.Add(s.valueSent, other.valueSent)
+	s.swept.Add(s.swept, other.swept)
+}
+
+// totalSpent is the ETH that's gone for good, rather than sitting with the fans or swept back
+func (s *spendTally) totalSpent() *big.Int {
+	total := new(big.Int).Add(s.fundingGas, s.fanGas)
+	return total.Add(total, s.valueSent)
+}
+
+// CurrentSpend accounts for the ETH the run has used so far
+func CurrentSpend() *Spend {
+	runSpendMu.Lock()
+	defer runSpendMu.Unlock()
+
+	remaining := new(big.Int).Sub(runSpend.funded, runSpend.fanGas)
+	remaining.Sub(remaining, runSpend.valueSent)
+	remaining.Sub(remaining, runSpend.swept)
+	total := runSpend.totalSpent()
+	spend := &Spend{
+		FundedWei:             runSpend.funded.String(),
+		GasSpentWei:           new(big.Int).Add(runSpend.fundingGas, runSpend.fanGas).String(),
+		ValueSentWei:          runSpend.valueSent.String(),
+		SweptWei:              runSpend.swept.String(),
+		EstimatedRemainingWei: remaining.String(),
+		TotalSpentWei:         total.String(),
+		BudgetExhausted:       budgetExhausted,
+	}
+	spend.TotalSpentEther, _ = convert.WeiToEther(total).Float64()
+	if config.Current != nil {
+		spend.BudgetEther = config.Current.BudgetEther
+	}
+	return spend
+}
+
+// accountBlock adds what the fans and funder spent in a block to the run's spend, using the receipts of their
+// transactions, and pauses the fans if that's used up the budget. Fans resumed while the run is still over budget are
+// paused again on the next block.
+func accountBlock(ctx context.Context, rpcClient *rpc.Client, block *types.Block, fanAddresses map[common.Address]struct{}) {
+	tally := newSpendTally()
+	if ours := ourTransactions(block, fanAddresses, config.Current.FundingAddress); len(ours) > 0 {
+		receipts := fetchReceipts(ctx, rpcClient, ours)
+		tally = tallyBlock(block, ours, receipts, fanAddresses, config.Current.FundingAddress)
+	}
+
+	runSpendMu.Lock()
+	defer runSpendMu.Unlock()
+	runSpend.add(tally)
+	budget := config.Current.BudgetWei
+	if budget == nil || budget.Sign() <= 0 || runSpend.totalSpent().Cmp(budget) < 0 {
+		return
+	}
+	budgetExhausted = true
+	if Paused() {
+		return
+	}
+	spentEther, _ := convert.WeiToEther(runSpend.totalSpent()).Float64()
+	log.Warn().
+		Float64("Spent ETH", spentEther).
+		Float64("Budget ETH", config.Current.BudgetEther).
+		Msg("Budget used up, pausing fans")
+	Pause()
+}
+
+// ourTransactions picks out the block's transactions sent by fans, or from the funder to fans, by their senders
+func ourTransactions(
+	block *types.Block,
+	fanAddresses map[common.Address]struct{},
+	funder common.Address,
+) map[common.Hash]common.Address {
+	ours := map[common.Hash]common.Address{}
+	for _, tx := range block.Transactions() {
+		if tx.To() == nil {
+			continue
+		}
+		sender, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+		if err != nil {
+			continue
+		}
+		_, fromFan := fanAddresses[sender]
+		_, toFan := fanAddresses[*tx.To()]
+		if fromFan || (sender == funder && toFan) {
+			ours[tx.Hash()] = sender
+		}
+	}
+	return ours
+}
+
+// fetchReceipts gets the receipts for transactions in one batch call. Receipts that can't be fetched are left out.
+func fetchReceipts(ctx context.Context, rpcClient *rpc.Client, txs map[common.Hash]common.Address) map[common.Hash]*types.Receipt {
+	receipts := make(map[common.Hash]*types.Receipt, len(txs))
+	batch := make([]rpc.BatchElem, 0, len(txs))
+	for hash := range txs {
+		receipt := &types.Receipt{}
+		receipts[hash] = receipt
+		batch = append(batch, rpc.BatchElem{Method: "eth_getTransactionReceipt", Args: []any{hash}, Result: receipt})
+	}
+	err := rpcLimiter.Do(ctx, func(ctx context.Context) error {
+		return rpcClient.BatchCallContext(ctx, batch)
+	})
+	if err != nil {
+		log.Warn().Err(err).Msg("Error fetching receipts, estimating gas spent instead")
+		return map[common.Hash]*types.Receipt{}
+	}
+	for _, elem := range batch {
+		if elem.Error != nil {
+			hash := elem.Args[0].(common.Hash)
+			log.Debug().Err(elem.Error).Str("Hash", hash.Hex()).Msg("Error fetching receipt, estimating gas spent instead")
+			delete(receipts, hash)
+		}
+	}
+	return receipts
+}
+
+// tallyBlock totals the spend of our transactions in a block. Gas comes from the receipts where there are any, and is
+// worked out from the block's base fee where there aren't. Transactions whose receipts say they failed only cost gas,
+// as their value never moved.
+func tallyBlock(
+	block *types.Block,
+	ours map[common.Hash]common.Address,
+	receipts map[common.Hash]*types.Receipt,
+	fanAddresses map[common.Address]struct{},
+	funder common.Address,
+) *spendTally {
+	tally := newSpendTally()
+	for _, tx := range block.Transactions() {
+		sender, ok := ours[tx.Hash()]
+		if !ok {
+			continue
+		}
+		receipt := receipts[tx.Hash()]
+		gas := gasCost(tx, receipt, block.BaseFee())
+		value := tx.Value()
+		if receipt != nil && receipt.Status == types.ReceiptStatusFailed {
+			value = big.NewInt(0)
+		}
+		if _, fromFan := fanAddresses[sender]; !fromFan {
+			tally.funded.Add(tally.funded, value)
+			tally.fundingGas.Add(tally.fundingGas, gas)
+			continue
+		}
+		tally.fanGas.Add(tally.fanGas, gas)
+		if *tx.To() == funder {
+			tally.swept.Add(tally.swept, value)
+		} else {
+			tally.valueSent.Add(tally.valueSent, value)
+		}
+	}
+	return tally
+}
+
+// gasCost is what a transaction paid for gas, from its receipt if there is one
+func gasCost(tx *types.Transaction, receipt *types.Receipt, baseFee *big.Int) *big.Int {
+	if receipt != nil && receipt.EffectiveGasPrice != nil {
+		return new(big.Int).Mul(receipt.EffectiveGasPrice, new(big.Int).SetUint64(receipt.GasUsed))
+	}
+	price := tx.EffectiveGasTipValue(baseFee)
+	if baseFee != nil {
+		price.Add(price, baseFee)
+	}
+	return price.Mul(price, new(big.Int).SetUint64(tx.Gas()))
+}
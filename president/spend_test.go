@@ -0,0 +1,124 @@
+package president
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kalverra/crazed-nft-fans/config"
+)
+
+var spendChainID = big.NewInt(1337)
+
+func transfer(t *testing.T, key *ecdsa.PrivateKey, nonce uint64, to common.Address, value int64) *types.Transaction {
+	t.Helper()
+	tx, err := types.SignNewTx(key, types.LatestSignerForChainID(spendChainID), &types.DynamicFeeTx{
+		ChainID:   spendChainID,
+		Nonce:     nonce,
+		To:        &to,
+		Value:     big.NewInt(value),
+		Gas:       21_000,
+		GasTipCap: big.NewInt(10),
+		GasFeeCap: big.NewInt(1000),
+	})
+	require.NoError(t, err, "Error signing transaction")
+	return tx
+}
+
+// standInEth serves the receipts it has, and nothing for transactions it doesn't
+type standInEth struct {
+	receipts map[common.Hash]*types.Receipt
+}
+
+func (s *standInEth) GetTransactionReceipt(hash common.Hash) (*types.Receipt, error) {
+	return s.receipts[hash], nil
+}
+
+// newReceipt is a successful receipt for a transfer, charged a gas price of 200
+func newReceipt(tx *types.Transaction) *types.Receipt {
+	return &types.Receipt{
+		Type:              types.DynamicFeeTxType,
+		Status:            types.ReceiptStatusSuccessful,
+		CumulativeGasUsed: 21_000,
+		Logs:              []*types.Log{},
+		TxHash:            tx.Hash(),
+		GasUsed:           21_000,
+		EffectiveGasPrice: big.NewInt(200),
+	}
+}
+
+func TestAccountBlock(t *testing.T) {
+	funderKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	fanKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	otherKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	funder, fan := crypto.PubkeyToAddress(funderKey.PublicKey), crypto.PubkeyToAddress(fanKey.PublicKey)
+
+	useConfig(t, &config.Config{FundingAddress: funder, BudgetEther: 0.000000000008, BudgetWei: big.NewInt(8_000_000)})
+	t.Cleanup(func() {
+		runSpend, budgetExhausted = newSpendTally(), false
+		Resume()
+	})
+
+	txs := []*types.Transaction{
+		transfer(t, funderKey, 0, fan, 1_000_000_000),
+		transfer(t, fanKey, 0, common.HexToAddress("0x42"), 42069),
+		transfer(t, fanKey, 1, funder, 500_000_000),
+		transfer(t, otherKey, 0, fan, 5), // Not ours, even though it's to a fan
+	}
+	eth := &standInEth{receipts: map[common.Hash]*types.Receipt{}}
+	for _, tx := range txs[:2] {
+		eth.receipts[tx.Hash()] = newReceipt(tx)
+	}
+	server := rpc.NewServer()
+	require.NoError(t, server.RegisterName("eth", eth))
+	t.Cleanup(server.Stop)
+
+	header := &types.Header{Number: big.NewInt(1), BaseFee: big.NewInt(100)}
+	block := types.NewBlockWithHeader(header).WithBody(txs, nil)
+	addresses := map[common.Address]struct{}{fan: {}}
+	accountBlock(context.Background(), rpc.DialInProc(server), block, addresses)
+
+	spend := CurrentSpend()
+	require.Equal(t, "1000000000", spend.FundedWei)
+	// Two receipts at 200 a gas, and the sweep without a receipt at its base fee plus tip of 110
+	require.Equal(t, "10710000", spend.GasSpentWei)
+	require.Equal(t, "42069", spend.ValueSentWei)
+	require.Equal(t, "500000000", spend.SweptWei)
+	require.Equal(t, "493447931", spend.EstimatedRemainingWei, "Funding gas is the funder's, not the fan's")
+	require.Equal(t, "10752069", spend.TotalSpentWei)
+	require.True(t, spend.BudgetExhausted, "Spend is over budget")
+	require.True(t, Paused(), "Fans should be paused when the budget runs out")
+
+	Resume()
+	empty := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(2), BaseFee: big.NewInt(100)})
+	accountBlock(context.Background(), rpc.DialInProc(server), empty, addresses)
+	require.True(t, Paused(), "Fans resumed while still over budget should be paused again on the next block")
+}
+
+func TestTallyFailedTransaction(t *testing.T) {
+	fanKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	fan, funder := crypto.PubkeyToAddress(fanKey.PublicKey), common.HexToAddress("0xf00")
+
+	tx := transfer(t, fanKey, 0, common.HexToAddress("0x42"), 42069)
+	receipt := newReceipt(tx)
+	receipt.Status = types.ReceiptStatusFailed
+	block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1), BaseFee: big.NewInt(100)}).
+		WithBody([]*types.Transaction{tx}, nil)
+	addresses := map[common.Address]struct{}{fan: {}}
+
+	tally := tallyBlock(block, ourTransactions(block, addresses, funder), map[common.Hash]*types.Receipt{tx.Hash(): receipt},
+		addresses, funder)
+	require.Equal(t, int64(4_200_000), tally.fanGas.Int64(), "Failed transactions still pay for gas")
+	require.Zero(t, tally.valueSent.Sign(), "Failed transactions don't send their value")
+}
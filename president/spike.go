@@ -0,0 +1,233 @@
+package president
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/kalverra/crazed-nft-fans/config"
+)
+
+// Decay is the shape a spike takes as it wears off
+type Decay string
+
+// Ways a spike can wear off
+const (
+	DecayInstant     Decay = "instant"     // Full multiplier until the spike ends, then straight back to the base
+	DecayLinear      Decay = "linear"      // Slides evenly from the full multiplier back to the base
+	DecayExponential Decay = "exponential" // Falls off quickly at first, then tapers back to the base
+)
+
+// SpikeConfig describes a spike in the target gas price. A spike lasts for either DurationBlocks or Duration. If
+// neither is set, the spike is permanent and folded into the base target.
+type SpikeConfig struct {
+	Multiplier     float64       `json:"multiplier"`
+	DurationBlocks uint64        `json:"durationBlocks,omitempty"`
+	Duration       time.Duration `json:"duration,omitempty"`
+	Decay          Decay         `json:"decay"`
+}
+
+// ActiveSpike is a spike currently applied to the target gas price
+type ActiveSpike struct {
+	ID                uint64      `json:"id"`
+	Config            SpikeConfig `json:"config"`
+	Started           time.Time   `json:"started"`
+	BlocksElapsed     uint64      `json:"blocksElapsed"`
+	CurrentMultiplier float64     `json:"currentMultiplier"`
+}
+
+var (
+	activeSpikes = []*ActiveSpike{} // guarded by targetMu
+	nextSpikeID  uint64
+)
+
+// Validate checks that the spike makes sense
+func (c *SpikeConfig) Validate() error {
+	if c.Multiplier <= 0 || math.IsInf(c.Multiplier, 0) || math.IsNaN(c.Multiplier) {
+		return fmt.Errorf("spike multiplier must be a positive number, got %f", c.Multiplier)
+	}
+	if c.DurationBlocks > 0 && c.Duration > 0 {
+		return errors.New("spike can last for a number of blocks or a duration, not both")
+	}
+	if c.Duration < 0 {
+		return fmt.Errorf("spike duration can't be negative, got %s", c.Duration)
+	}
+	switch c.Decay {
+	case DecayInstant, DecayLinear, DecayExponential:
+	default:
+		return fmt.Errorf("unknown spike decay '%s', must be one of %s, %s, %s", c.Decay, DecayInstant, DecayLinear, DecayExponential)
+	}
+	return nil
+}
+
+// Permanent returns whether the spike never wears off
+func (c *SpikeConfig) Permanent() bool {
+	return c.DurationBlocks == 0 && c.Duration == 0
+}
+
+// DefaultSpike is the spike from config that the dashboard's spike button uses. A configured duration takes
+// precedence over a number of blocks.
+func DefaultSpike() SpikeConfig {
+	spike := SpikeConfig{
+		Multiplier:     config.Current.SpikeMultiplier,
+		DurationBlocks: config.Current.SpikeDurationBlocks,
+		Duration:       config.Current.SpikeDuration,
+		Decay:          Decay(config.Current.SpikeDecay),
+	}
+	if spike.Duration > 0 {
+		spike.DurationBlocks = 0
+	}
+	return spike
+}
+
+// TempSpike applies the default spike from config
+func TempSpike() *big.Int {
+	newLevel, err := Spike(DefaultSpike())
+	if err != nil {
+		log.Error().Err(err).Msg("Default spike is invalid, check config")
+		return GasTarget()
+	}
+	return newLevel
+}
+
+// PermanentSpike multiplies the base target gas price by the default spike multiplier until it's changed again
+func PermanentSpike() *big.Int {
+	newLevel, err := Spike(SpikeConfig{Multiplier: config.Current.SpikeMultiplier, Decay: DecayInstant})
+	if err != nil {
+		log.Error().Err(err).Msg("Default spike is invalid, check config")
+		return GasTarget()
+	}
+	return newLevel
+}
+
+// Spike adds a spike on top of the target gas price, returning the new target. Spikes stack by multiplying together,
+// and once they've all worn off the target returns to its base.
+func Spike(spike SpikeConfig) (*big.Int, error) {
+	if err := spike.Validate(); err != nil {
+		return nil, err
+	}
+	targetMu.Lock()
+	defer targetMu.Unlock()
+
+	oldLevel, _ := effectiveTarget()
+	if spike.Permanent() {
+		setBaseTarget(multiplyWei(baseTargetGasPrice, spike.Multiplier))
+	} else {
+		nextSpikeID++
+		activeSpikes = append(activeSpikes, &ActiveSpike{
+			ID:                nextSpikeID,
+			Config:            spike,
+			Started:           time.Now(),
+			CurrentMultiplier: spike.Multiplier,
+		})
+	}
+	newLevel, clamped := effectiveTarget()
+	log.Info().
+		Str("New Level", newLevel.String()).
+		Str("Old Level", oldLevel.String()).
+		Float64("Multiplier", spike.Multiplier).
+		Uint64("Duration Blocks", spike.DurationBlocks).
+		Str("Duration", spike.Duration.String()).
+		Str("Decay", string(spike.Decay)).
+		Bool("Permanent", spike.Permanent()).
+		Bool("Clamped", clamped).
+		Msg("Spiking Gas Price")
+	return newLevel, nil
+}
+
+// ActiveSpikes lists the spikes currently applied to the target gas price
+func ActiveSpikes() []ActiveSpike {
+	targetMu.RLock()
+	defer targetMu.RUnlock()
+
+	spikes := make([]ActiveSpike, 0, len(activeSpikes))
+	now := time.Now()
+	for _, spike := range activeSpikes {
+		current := *spike
+		current.CurrentMultiplier = spike.multiplierAt(now)
+		spikes = append(spikes, current)
+	}
+	return spikes
+}
+
+// ClearSpikes ends every active spike, returning the target to its base
+func ClearSpikes() *big.Int {
+	targetMu.Lock()
+	defer targetMu.Unlock()
+	activeSpikes = []*ActiveSpike{}
+	return new(big.Int).Set(baseTargetGasPrice)
+}
+
+// Spiking returns whether any spikes are active
+func Spiking() bool {
+	targetMu.RLock()
+	defer targetMu.RUnlock()
+	now := time.Now()
+	for _, spike := range activeSpikes {
+		if spike.progress(now) < 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// tickSpike counts a block against every block based spike, and drops any spikes that have worn off
+func tickSpike() {
+	targetMu.Lock()
+	defer targetMu.Unlock()
+
+	now := time.Now()
+	stillActive := activeSpikes[:0]
+	for _, spike := range activeSpikes {
+		spike.BlocksElapsed++
+		if spike.progress(now) >= 1 {
+			log.Info().Uint64("ID", spike.ID).Float64("Multiplier", spike.Config.Multiplier).Msg("Spike over")
+			continue
+		}
+		stillActive = append(stillActive, spike)
+	}
+	activeSpikes = stillActive
+}
+
+// spikeMultiplier is the combined multiplier of every active spike. The caller must hold targetMu.
+func spikeMultiplier() float64 {
+	multiplier := 1.0
+	now := time.Now()
+	for _, spike := range activeSpikes {
+		multiplier *= spike.multiplierAt(now)
+	}
+	return multiplier
+}
+
+// progress is how far through its lifetime the spike is, from 0 to 1
+func (s *ActiveSpike) progress(now time.Time) float64 {
+	var progress float64
+	if s.Config.DurationBlocks > 0 {
+		progress = float64(s.BlocksElapsed) / float64(s.Config.DurationBlocks)
+	} else {
+		progress = float64(now.Sub(s.Started)) / float64(s.Config.Duration)
+	}
+	return math.Min(math.Max(progress, 0), 1)
+}
+
+// multiplierAt is how much the spike is multiplying the target by at the given time, based on its decay
+func (s *ActiveSpike) multiplierAt(now time.Time) float64 {
+	progress := s.progress(now)
+	if progress >= 1 {
+		return 1
+	}
+	switch s.Config.Decay {
+	case DecayLinear:
+		return 1 + (s.Config.Multiplier-1)*(1-progress)
+	case DecayExponential:
+		return math.Pow(s.Config.Multiplier, 1-progress)
+	case DecayInstant:
+		return s.Config.Multiplier
+	default:
+		return s.Config.Multiplier
+	}
+}
@@ -0,0 +1,79 @@
+package president
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpikeStackRestoresBase(t *testing.T) {
+	SetGasTarget(big.NewInt(100))
+	t.Cleanup(func() { ClearSpikes() })
+
+	_, err := Spike(SpikeConfig{Multiplier: 10, DurationBlocks: 1, Decay: DecayInstant})
+	require.NoError(t, err, "Error spiking")
+	_, err = Spike(SpikeConfig{Multiplier: 2, DurationBlocks: 3, Decay: DecayInstant})
+	require.NoError(t, err, "Error spiking")
+	require.Equal(t, int64(2000), GasTarget().Int64(), "Spikes should stack")
+
+	tickSpike()
+	require.Equal(t, int64(200), GasTarget().Int64(), "First spike should have worn off")
+	require.Equal(t, int64(100), BaseGasTarget().Int64(), "Base should be untouched by spikes")
+	tickSpike()
+	tickSpike()
+	require.Equal(t, int64(100), GasTarget().Int64(), "Target should be back to base")
+	require.False(t, Spiking())
+}
+
+func TestTargetBand(t *testing.T) {
+	require.NoError(t, SetGasTargetBand(big.NewInt(10), big.NewInt(1000)))
+	t.Cleanup(func() {
+		ClearSpikes()
+		floorGasPrice, peakGasPrice = big.NewInt(1), nil
+	})
+
+	require.Equal(t, int64(1000), SetGasTarget(big.NewInt(5000)).Int64(), "Target should be held to the peak")
+	require.True(t, TargetClamped())
+	SetGasTarget(big.NewInt(10))
+	require.Equal(t, int64(10), DecreaseGasTarget().Int64(), "Target should never drop below the floor")
+
+	SetGasTarget(big.NewInt(500))
+	require.False(t, TargetClamped())
+	_, err := Spike(SpikeConfig{Multiplier: 10, DurationBlocks: 1, Decay: DecayInstant})
+	require.NoError(t, err, "Error spiking")
+	require.Equal(t, int64(1000), GasTarget().Int64(), "Spikes should be held to the peak")
+	require.True(t, TargetClamped())
+	require.Equal(t, int64(500), BaseGasTarget().Int64())
+
+	require.Error(t, SetGasTargetBand(big.NewInt(100), big.NewInt(10)), "Floor above the peak should error")
+}
+
+func TestSpikeDecay(t *testing.T) {
+	halfway := time.Now()
+	spike := func(decay Decay) *ActiveSpike {
+		return &ActiveSpike{
+			Config:        SpikeConfig{Multiplier: 9, DurationBlocks: 4, Decay: decay},
+			Started:       halfway,
+			BlocksElapsed: 2,
+		}
+	}
+	require.InDelta(t, 9, spike(DecayInstant).multiplierAt(halfway), 0.0001)
+	require.InDelta(t, 5, spike(DecayLinear).multiplierAt(halfway), 0.0001)
+	require.InDelta(t, 3, spike(DecayExponential).multiplierAt(halfway), 0.0001)
+
+	over := spike(DecayLinear)
+	over.BlocksElapsed = 4
+	require.InDelta(t, 1, over.multiplierAt(halfway), 0.0001, "Finished spike shouldn't multiply anything")
+}
+
+func TestPermanentSpike(t *testing.T) {
+	SetGasTarget(big.NewInt(100))
+	t.Cleanup(func() { ClearSpikes() })
+
+	_, err := Spike(SpikeConfig{Multiplier: 3, Decay: DecayInstant})
+	require.NoError(t, err, "Error spiking")
+	require.Equal(t, int64(300), BaseGasTarget().Int64(), "Permanent spike should move the base")
+	require.Empty(t, ActiveSpikes())
+}
@@ -0,0 +1,71 @@
+package president
+
+import (
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/kalverra/crazed-nft-fans/throttle"
+)
+
+// RunSummary sums up what the fans have been up to since WatchChain started
+type RunSummary struct {
+	Duration            time.Duration  `json:"duration"`
+	FirstBlock          uint64         `json:"firstBlock"`
+	LastBlock           uint64         `json:"lastBlock"`
+	BlocksTracked       int            `json:"blocksTracked"`
+	Fans                int            `json:"fans"`
+	FundedFans          int            `json:"fundedFans"`
+	PendingTransactions int            `json:"pendingTransactions"`
+	Spend               *Spend         `json:"spend"`
+	Throttling          throttle.Stats `json:"throttling"`
+}
+
+// Summary builds a summary of the run so far
+func Summary() *RunSummary {
+	club := Fans()
+	summary := &RunSummary{
+		Fans:       len(club),
+		Spend:      CurrentSpend(),
+		Throttling: RPCThrottling(),
+	}
+	if !runStarted.IsZero() {
+		summary.Duration = time.Since(runStarted)
+	}
+	blocks := AllBlocks()
+	summary.BlocksTracked = len(blocks)
+	if len(blocks) > 0 {
+		summary.FirstBlock, summary.LastBlock = blocks[0].Number, blocks[len(blocks)-1].Number
+	}
+	for _, fan := range club {
+		if fan.Funded() {
+			summary.FundedFans++
+		}
+		summary.PendingTransactions += fan.PendingTransactions()
+	}
+	return summary
+}
+
+// Log writes the summary out to the logs
+func (s *RunSummary) Log() {
+	log.Info().
+		Str("Duration", s.Duration.Round(time.Second).String()).
+		Uint64("First Block", s.FirstBlock).
+		Uint64("Last Block", s.LastBlock).
+		Int("Blocks Tracked", s.BlocksTracked).
+		Int("Fans", s.Fans).
+		Int("Funded Fans", s.FundedFans).
+		Int("Pending Transactions", s.PendingTransactions).
+		Str("Funded Wei", s.Spend.FundedWei).
+		Str("Gas Spent Wei", s.Spend.GasSpentWei).
+		Str("Value Sent Wei", s.Spend.ValueSentWei).
+		Str("Swept Wei", s.Spend.SweptWei).
+		Str("Estimated Remaining Wei", s.Spend.EstimatedRemainingWei).
+		Float64("Total Spent ETH", s.Spend.TotalSpentEther).
+		Bool("Budget Exhausted", s.Spend.BudgetExhausted).
+		Uint64("RPC Calls", s.Throttling.Calls).
+		Uint64("RPC Calls Throttled", s.Throttling.Throttled).
+		Uint64("RPC Calls Rejected", s.Throttling.Rejected).
+		Uint64("RPC Calls Shed", s.Throttling.Shed).
+		Msg("Run summary")
+}
@@ -0,0 +1,136 @@
+package president
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	targetMu           sync.RWMutex
+	baseTargetGasPrice = big.NewInt(35000000000) // 35 gwei, a common baseline
+	gasPriceIncrement  = big.NewInt(1000000000)  // 1 gwei
+	// The band the target is held within. Set from config when watching the chain, until then there's no peak.
+	floorGasPrice = big.NewInt(1)
+	peakGasPrice  *big.Int
+	baseClamped   bool // whether the last base target asked for was outside the band
+)
+
+// GasTarget returns the gas price the fans are currently aiming for, the base target with any active spikes applied,
+// held within the floor and peak
+func GasTarget() *big.Int {
+	targetMu.RLock()
+	defer targetMu.RUnlock()
+	target, _ := effectiveTarget()
+	return target
+}
+
+// TargetClamped returns whether the target is being held to the floor or peak, either because the base target asked
+// for was outside of them, or because spikes are pushing it past them
+func TargetClamped() bool {
+	targetMu.RLock()
+	defer targetMu.RUnlock()
+	_, clamped := effectiveTarget()
+	return clamped || baseClamped
+}
+
+// BaseGasTarget returns the gas price the fans aim for when nothing is spiking
+func BaseGasTarget() *big.Int {
+	targetMu.RLock()
+	defer targetMu.RUnlock()
+	return new(big.Int).Set(baseTargetGasPrice)
+}
+
+// SetGasTarget sets a new base gas price for the fans to aim for, held within the floor and peak. Active spikes
+// still apply on top of it.
+func SetGasTarget(gasPrice *big.Int) *big.Int {
+	targetMu.Lock()
+	defer targetMu.Unlock()
+	setBaseTarget(gasPrice)
+	target, _ := effectiveTarget()
+	return target
+}
+
+// IncreaseGasTarget bumps the base target gas price up by a gwei, up to the peak
+func IncreaseGasTarget() *big.Int {
+	targetMu.Lock()
+	defer targetMu.Unlock()
+	setBaseTarget(new(big.Int).Add(baseTargetGasPrice, gasPriceIncrement))
+	target, _ := effectiveTarget()
+	return target
+}
+
+// DecreaseGasTarget drops the base target gas price down by a gwei, down to the floor
+func DecreaseGasTarget() *big.Int {
+	targetMu.Lock()
+	defer targetMu.Unlock()
+	setBaseTarget(new(big.Int).Sub(baseTargetGasPrice, gasPriceIncrement))
+	target, _ := effectiveTarget()
+	return target
+}
+
+// GasTargetBand returns the floor and peak the target is held within. A nil peak means there isn't one.
+func GasTargetBand() (floor, peak *big.Int) {
+	targetMu.RLock()
+	defer targetMu.RUnlock()
+	if peakGasPrice != nil {
+		peak = new(big.Int).Set(peakGasPrice)
+	}
+	return new(big.Int).Set(floorGasPrice), peak
+}
+
+// SetGasTargetBand changes the floor and peak the target is held within, moving the base target inside them if
+// it's now outside
+func SetGasTargetBand(floor, peak *big.Int) error {
+	if floor == nil || floor.Sign() <= 0 {
+		return errors.New("floor gas price must be greater than 0")
+	}
+	if peak == nil || peak.Cmp(floor) < 0 {
+		return fmt.Errorf("peak gas price %s can't be below the floor gas price %s", peak, floor)
+	}
+	targetMu.Lock()
+	defer targetMu.Unlock()
+	floorGasPrice, peakGasPrice = new(big.Int).Set(floor), new(big.Int).Set(peak)
+	setBaseTarget(baseTargetGasPrice)
+	log.Info().Str("Floor", floor.String()).Str("Peak", peak.String()).Msg("Set target gas price band")
+	return nil
+}
+
+// setBaseTarget sets the base target, clamped to the band. The caller must hold targetMu.
+func setBaseTarget(gasPrice *big.Int) {
+	baseTargetGasPrice, baseClamped = clampWei(gasPrice)
+	if baseClamped {
+		log.Warn().
+			Str("Requested", gasPrice.String()).
+			Str("Target", baseTargetGasPrice.String()).
+			Msg("Target gas price outside of the floor and peak, clamping it")
+	}
+}
+
+// effectiveTarget is the base target with active spikes applied, clamped to the band. The caller must hold targetMu.
+func effectiveTarget() (*big.Int, bool) {
+	return clampWei(multiplyWei(baseTargetGasPrice, spikeMultiplier()))
+}
+
+// clampWei holds a gas price within the band, returning whether it had to. The caller must hold targetMu.
+func clampWei(gasPrice *big.Int) (*big.Int, bool) {
+	switch {
+	case gasPrice.Cmp(floorGasPrice) < 0:
+		return new(big.Int).Set(floorGasPrice), true
+	case peakGasPrice != nil && gasPrice.Cmp(peakGasPrice) > 0:
+		return new(big.Int).Set(peakGasPrice), true
+	default:
+		return new(big.Int).Set(gasPrice), false
+	}
+}
+
+// multiplyWei multiplies a wei amount by a float, truncating the result
+func multiplyWei(wei *big.Int, multiplier float64) *big.Int {
+	product := new(big.Float).SetInt(wei)
+	product.Mul(product, big.NewFloat(multiplier))
+	result, _ := product.Int(nil)
+	return result
+}
@@ -0,0 +1,149 @@
+package president
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/rs/zerolog/log"
+
+	"github.com/kalverra/crazed-nft-fans/config"
+	"github.com/kalverra/crazed-nft-fans/fans"
+)
+
+// SendMode is when fans send their transactions
+type SendMode string
+
+// Ways fans can send transactions
+const (
+	SendOnBlock SendMode = "block" // All at once, right after each new block arrives
+	SendOnTimer SendMode = "timer" // Each fan on its own random timer, spread across the block interval
+)
+
+// blockIntervalSample is how many recent blocks to average when estimating the block interval
+const blockIntervalSample = 10
+
+var (
+	sendModeMu sync.RWMutex
+	sendMode   = SendOnBlock
+
+	timerMu              sync.Mutex
+	timerSenders         = map[*fans.Fan]context.CancelFunc{}
+	fanTxPerSecond       = map[*fans.Fan]float64{}
+	latestBaseFee        *big.Int
+	latestTargetGasPrice *big.Int
+)
+
+// Validate checks that the send mode is one we know
+func (m SendMode) Validate() error {
+	switch m {
+	case SendOnBlock, SendOnTimer:
+		return nil
+	default:
+		return fmt.Errorf("unknown send mode '%s', must be one of %s, %s", m, SendOnBlock, SendOnTimer)
+	}
+}
+
+// CurrentSendMode returns when fans are sending their transactions
+func CurrentSendMode() SendMode {
+	sendModeMu.RLock()
+	defer sendModeMu.RUnlock()
+	return sendMode
+}
+
+// SetSendMode changes when fans send their transactions, taking effect on the next block
+func SetSendMode(mode SendMode) error {
+	if err := mode.Validate(); err != nil {
+		return err
+	}
+	sendModeMu.Lock()
+	defer sendModeMu.Unlock()
+	sendMode = mode
+	log.Info().Str("Mode", string(mode)).Msg("Set send mode")
+	return nil
+}
+
+// BlockInterval estimates the time between blocks from recently tracked blocks, falling back to the configured
+// expected block time
+func BlockInterval() time.Duration {
+	blocks := AllBlocks()
+	if len(blocks) > blockIntervalSample {
+		blocks = blocks[len(blocks)-blockIntervalSample:]
+	}
+	if len(blocks) >= 2 {
+		first, last := blocks[0], blocks[len(blocks)-1]
+		if last.Timestamp > first.Timestamp && last.Number > first.Number {
+			seconds := float64(last.Timestamp-first.Timestamp) / float64(last.Number-first.Number)
+			return time.Duration(seconds * float64(time.Second))
+		}
+	}
+	return config.Current.ExpectedBlockTime
+}
+
+// syncTimerSenders makes sure every fan in the club has a timer sending for it when in timer mode, and that no
+// timers are left running otherwise
+func syncTimerSenders(ctx context.Context, timerMode bool) {
+	timerMu.Lock()
+	defer timerMu.Unlock()
+
+	active := map[*fans.Fan]struct{}{}
+	if timerMode {
+		for _, fan := range Fans() {
+			active[fan] = struct{}{}
+		}
+	}
+	for fan, cancel := range timerSenders {
+		if _, ok := active[fan]; !ok {
+			cancel()
+			delete(timerSenders, fan)
+			delete(fanTxPerSecond, fan)
+		}
+	}
+	for f := range active {
+		if _, ok := timerSenders[f]; ok {
+			continue
+		}
+		fan := f
+		senderCtx, cancel := context.WithCancel(ctx)
+		timerSenders[fan] = cancel
+		goWatch(func() {
+			fan.SendOnTimer(senderCtx, func() fans.SendConditions { return sendConditions(fan) }, func(err error) {
+				handleFanError(ctx, err)
+			})
+		})
+	}
+}
+
+// updateMarket spreads each timer sending fan's transactions for the next block across the expected block interval
+func updateMarket(block *types.Block, targetGasPrice *big.Int) {
+	interval := BlockInterval().Seconds()
+	rate, sending := currentRateModel(), sendingFanCount()
+
+	timerMu.Lock()
+	defer timerMu.Unlock()
+	latestBaseFee, latestTargetGasPrice = block.BaseFee(), targetGasPrice
+	for fan := range timerSenders {
+		txCount := rate.TransactionsPerBlock(block.GasLimit(), sending)
+		if interval > 0 {
+			fanTxPerSecond[fan] = float64(txCount) / interval
+		}
+	}
+}
+
+// sendConditions is what a fan sending on a timer should be doing right now
+func sendConditions(fan *fans.Fan) fans.SendConditions {
+	timerMu.Lock()
+	defer timerMu.Unlock()
+	conditions := fans.SendConditions{
+		TxPerSecond:    fanTxPerSecond[fan],
+		BaseFee:        latestBaseFee,
+		TargetGasPrice: latestTargetGasPrice,
+	}
+	if Paused() {
+		conditions.TxPerSecond = 0
+	}
+	return conditions
+}
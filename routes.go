@@ -1,7 +1,7 @@
 package main
 
 import (
-	"encoding/json"
+	"math"
 	"net/http"
 	"strconv"
 	"time"
@@ -10,7 +10,7 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/rs/zerolog/log"
 
-	"github.com/kalverra/crazed-nft-fans/convert"
+	"github.com/kalverra/crazed-nft-fans/config"
 	"github.com/kalverra/crazed-nft-fans/president"
 )
 
@@ -19,16 +19,17 @@ func buildRoutes() *http.Server {
 	// r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 
-	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, "dash.html")
-	})
+	r.Get("/", dashboard)
+	r.Handle("/static/*", http.FileServer(http.FS(staticFiles)))
 	r.Get("/blockData", blockData)
+	r.Get("/mempool", mempool)
 	r.Put("/increaseIntensity", increaseIntensity)
 	r.Put("/decreaseIntensity", decreaseIntensity)
 	r.Put("/spike", spike)
+	r.Route("/api/v1", apiRoutes)
 
 	return &http.Server{
-		Addr:         ":3333",
+		Addr:         config.Current.ListenAddress,
 		Handler:      r,
 		ReadTimeout:  time.Second * 10,
 		WriteTimeout: time.Second * 10,
@@ -38,8 +39,10 @@ func buildRoutes() *http.Server {
 func blockData(w http.ResponseWriter, r *http.Request) {
 	var blocks []*president.TrackedBlock
 
-	blockNumber := r.URL.Query().Get("blockNumber")
-	if blockNumber != "" {
+	query := r.URL.Query()
+	blockNumber, from, to := query.Get("blockNumber"), query.Get("from"), query.Get("to")
+	switch {
+	case blockNumber != "":
 		blockNum, err := strconv.ParseUint(blockNumber, 10, 64)
 		if err != nil {
 			log.Error().Err(err).Msg("Error parsing block number")
@@ -47,51 +50,51 @@ func blockData(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		blocks = president.BlocksSinceNumber(blockNum)
-	} else {
+	case from != "" || to != "":
+		fromNum, toNum := uint64(0), uint64(math.MaxUint64)
+		var err error
+		if from != "" {
+			if fromNum, err = strconv.ParseUint(from, 10, 64); err != nil {
+				log.Error().Err(err).Msg("Error parsing from block number")
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		if to != "" {
+			if toNum, err = strconv.ParseUint(to, 10, 64); err != nil {
+				log.Error().Err(err).Msg("Error parsing to block number")
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		blocks, err = president.BlocksInRange(fromNum, toNum)
+		if err != nil {
+			log.Error().Err(err).Msg("Error reading block range")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	default:
 		blocks = president.AllBlocks()
 	}
 
-	ret, err := json.Marshal(blocks)
-	if err != nil {
-		log.Error().Err(err).Msg("Error marshaling blocks")
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
+	writeJSON(w, http.StatusOK, blocks)
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	_, err = w.Write(ret)
-	if err != nil {
-		log.Error().Err(err).Msg("Error writing response")
-		w.WriteHeader(http.StatusInternalServerError)
-	}
+func mempool(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, president.Mempool())
 }
 
-// TODO: could clean this up
+// increaseIntensity is a legacy route that responds with the bare new target in gwei
 func increaseIntensity(w http.ResponseWriter, r *http.Request) {
-	newTarget := president.IncreaseGasTarget()
-	w.Header().Set("Content-Type", "application/json")
-	_, err := w.Write([]byte(convert.WeiToGwei(newTarget).String()))
-	if err != nil {
-		log.Error().Err(err).Msg("Error writing response")
-		w.WriteHeader(http.StatusInternalServerError)
-	}
+	writeJSON(w, http.StatusOK, newTargetResponse(president.IncreaseGasTarget()).TargetGasPriceGwei)
 }
 
+// decreaseIntensity is a legacy route that responds with the bare new target in gwei
 func decreaseIntensity(w http.ResponseWriter, r *http.Request) {
-	newTarget := president.DecreaseGasTarget()
-	w.Header().Set("Content-Type", "application/json")
-	_, err := w.Write([]byte(convert.WeiToGwei(newTarget).String()))
-	if err != nil {
-		log.Error().Err(err).Msg("Error writing response")
-		w.WriteHeader(http.StatusInternalServerError)
-	}
+	writeJSON(w, http.StatusOK, newTargetResponse(president.DecreaseGasTarget()).TargetGasPriceGwei)
 }
 
+// spike is a legacy route that responds with the bare new target in gwei
 func spike(w http.ResponseWriter, r *http.Request) {
-	newTarget := president.TempSpike()
-	_, err := w.Write([]byte(convert.WeiToGwei(newTarget).String()))
-	if err != nil {
-		log.Error().Err(err).Msg("Error writing response")
-		w.WriteHeader(http.StatusInternalServerError)
-	}
+	writeJSON(w, http.StatusOK, newTargetResponse(president.TempSpike()).TargetGasPriceGwei)
 }
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"io/fs"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// staticFiles holds the dashboard and the JS it loads, so the binary can serve them from anywhere, even offline
+//
+//go:embed static
+var staticFiles embed.FS
+
+// dashboard serves the embedded dashboard page
+func dashboard(w http.ResponseWriter, r *http.Request) {
+	dash, err := fs.ReadFile(staticFiles, "static/dash.html")
+	if err != nil {
+		log.Error().Err(err).Msg("Error reading embedded dashboard")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	http.ServeContent(w, r, "dash.html", time.Time{}, bytes.NewReader(dash))
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaticFiles(t *testing.T) {
+	handler := buildRoutes().Handler
+
+	for path, contentType := range map[string]string{
+		"/":                       "text/html; charset=utf-8",
+		"/static/js/chart.min.js": "text/javascript; charset=utf-8",
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusOK, rec.Code, "Should serve %s from the binary", path)
+		require.Equal(t, contentType, rec.Header().Get("Content-Type"), path)
+		require.NotEmpty(t, rec.Body.Bytes(), path)
+	}
+}
@@ -0,0 +1,206 @@
+// Package throttle limits how fast, and how many at once, RPC calls are made to the node, so the fans can load it
+// without taking it down
+package throttle
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"golang.org/x/time/rate"
+)
+
+// ErrShed is returned for calls dropped because they went stale before the limits allowed them
+var ErrShed = errors.New("rpc call shed")
+
+// throttledAfter is how long a call has to wait before it counts as throttled
+const throttledAfter = time.Millisecond
+
+// Limiter holds RPC calls to a rate and a number in flight. A nil Limiter doesn't limit anything.
+type Limiter struct {
+	ratePerSecond float64
+	burst         int
+	maxConcurrent int
+	limiter       *rate.Limiter // nil when there's no rate limit
+	slots         chan struct{} // nil when there's no concurrency limit
+
+	statsMu      sync.Mutex
+	calls        uint64
+	throttled    uint64
+	totalWait    time.Duration
+	maxWait      time.Duration
+	inFlight     int
+	peakInFlight int
+	rejected     uint64
+	shed         uint64
+}
+
+// Stats describes how much RPC calls have been held back, and how often the node has turned them away anyway
+type Stats struct {
+	RatePerSecond float64 `json:"ratePerSecond"` // 0 when there's no rate limit
+	Burst         int     `json:"burst"`
+	MaxConcurrent int     `json:"maxConcurrent"` // 0 when there's no concurrency limit
+	Calls         uint64  `json:"calls"`
+	Throttled     uint64  `json:"throttled"` // Calls that had to wait for the rate limit or a free slot
+	AvgWaitMs     float64 `json:"avgWaitMs"` // Average wait of the throttled calls
+	MaxWaitMs     int64   `json:"maxWaitMs"`
+	InFlight      int     `json:"inFlight"`
+	PeakInFlight  int     `json:"peakInFlight"`
+	Rejected      uint64  `json:"rejected"` // Calls the node refused for making too many requests
+	Shed          uint64  `json:"shed"`     // Calls dropped because they went stale while waiting
+}
+
+// New makes a Limiter allowing ratePerSecond calls a second, in bursts of up to burst, with at most maxConcurrent
+// in flight. A ratePerSecond or maxConcurrent of 0 turns that limit off.
+func New(ratePerSecond float64, burst, maxConcurrent int) *Limiter {
+	l := &Limiter{ratePerSecond: ratePerSecond, burst: burst, maxConcurrent: maxConcurrent}
+	if ratePerSecond > 0 {
+		l.limiter = rate.NewLimiter(rate.Limit(ratePerSecond), burst)
+	}
+	if maxConcurrent > 0 {
+		l.slots = make(chan struct{}, maxConcurrent)
+	}
+	return l
+}
+
+// Do makes an RPC call with fn once the limits allow it, or returns ctx's error if ctx is done first
+func (l *Limiter) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	return l.DoUnlessStale(ctx, ctx, fn)
+}
+
+// DoUnlessStale is Do for calls only worth making until stale is done, like a block's transactions once the next block
+// has arrived. Calls still waiting when stale is done are dropped, counted as shed, and return ErrShed. stale should
+// be derived from ctx. Calls that are made run with ctx, so they aren't cut short once they've started.
+func (l *Limiter) DoUnlessStale(ctx, stale context.Context, fn func(ctx context.Context) error) error {
+	if l == nil {
+		return fn(ctx)
+	}
+	if err := l.wait(ctx, stale); err != nil {
+		return err
+	}
+	if l.slots != nil {
+		defer func() { <-l.slots }()
+	}
+
+	err := fn(ctx)
+	l.finish(err)
+	return err
+}
+
+// wait holds a call until the limits allow it, taking a slot if there's a concurrency limit
+func (l *Limiter) wait(ctx, stale context.Context) error {
+	start := time.Now()
+	if stale.Err() != nil {
+		return l.giveUp(ctx)
+	}
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-stale.Done():
+			return l.giveUp(ctx)
+		}
+	}
+	if l.limiter != nil {
+		if err := l.limiter.Wait(stale); err != nil {
+			if l.slots != nil {
+				<-l.slots
+			}
+			if stale.Err() != nil {
+				return l.giveUp(ctx)
+			}
+			return err
+		}
+	}
+	l.start(time.Since(start))
+	return nil
+}
+
+// giveUp stops waiting on a call, which is shed unless ctx itself is done
+func (l *Limiter) giveUp(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	l.statsMu.Lock()
+	defer l.statsMu.Unlock()
+	l.shed++
+	return ErrShed
+}
+
+// Call makes an RPC call returning a value with fn once l allows it
+func Call[T any](ctx context.Context, l *Limiter, fn func(ctx context.Context) (T, error)) (T, error) {
+	var result T
+	err := l.Do(ctx, func(ctx context.Context) error {
+		var err error
+		result, err = fn(ctx)
+		return err
+	})
+	return result, err
+}
+
+// Stats returns how much calls have been held back so far
+func (l *Limiter) Stats() Stats {
+	if l == nil {
+		return Stats{}
+	}
+	l.statsMu.Lock()
+	defer l.statsMu.Unlock()
+	stats := Stats{
+		RatePerSecond: l.ratePerSecond,
+		Burst:         l.burst,
+		MaxConcurrent: l.maxConcurrent,
+		Calls:         l.calls,
+		Throttled:     l.throttled,
+		MaxWaitMs:     l.maxWait.Milliseconds(),
+		InFlight:      l.inFlight,
+		PeakInFlight:  l.peakInFlight,
+		Rejected:      l.rejected,
+		Shed:          l.shed,
+	}
+	if l.throttled > 0 {
+		stats.AvgWaitMs = float64(l.totalWait.Microseconds()) / float64(l.throttled) / 1000
+	}
+	return stats
+}
+
+func (l *Limiter) start(waited time.Duration) {
+	l.statsMu.Lock()
+	defer l.statsMu.Unlock()
+	l.calls++
+	if waited >= throttledAfter {
+		l.throttled++
+		l.totalWait += waited
+	}
+	if waited > l.maxWait {
+		l.maxWait = waited
+	}
+	l.inFlight++
+	if l.inFlight > l.peakInFlight {
+		l.peakInFlight = l.inFlight
+	}
+}
+
+func (l *Limiter) finish(err error) {
+	l.statsMu.Lock()
+	defer l.statsMu.Unlock()
+	l.inFlight--
+	if tooManyRequests(err) {
+		l.rejected++
+	}
+}
+
+// tooManyRequests is whether the node refused a call for making too many of them
+func tooManyRequests(err error) bool {
+	if err == nil {
+		return false
+	}
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "too many requests") || strings.Contains(message, "rate limit")
+}
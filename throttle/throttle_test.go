@@ -0,0 +1,100 @@
+package throttle_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kalverra/crazed-nft-fans/throttle"
+)
+
+func TestConcurrencyLimit(t *testing.T) {
+	limiter := throttle.New(0, 0, 2)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := limiter.Do(context.Background(), func(ctx context.Context) error {
+				time.Sleep(20 * time.Millisecond)
+				return nil
+			})
+			require.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	stats := limiter.Stats()
+	require.Equal(t, uint64(6), stats.Calls)
+	require.Equal(t, 2, stats.PeakInFlight, "No more than 2 calls should be in flight at once")
+	require.Zero(t, stats.InFlight)
+	require.Positive(t, stats.Throttled, "Calls past the first 2 should have waited for a slot")
+}
+
+func TestRateLimit(t *testing.T) {
+	limiter := throttle.New(100, 1, 0)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		require.NoError(t, limiter.Do(context.Background(), func(ctx context.Context) error { return nil }))
+	}
+	require.GreaterOrEqual(t, time.Since(start), 35*time.Millisecond, "5 calls at 100 a second shouldn't all go at once")
+
+	stats := limiter.Stats()
+	require.Equal(t, uint64(5), stats.Calls)
+	require.Equal(t, uint64(4), stats.Throttled, "Every call after the burst should have waited")
+	require.Positive(t, stats.AvgWaitMs)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.Error(t, limiter.Do(ctx, func(ctx context.Context) error { return nil }), "Done contexts shouldn't wait")
+}
+
+func TestShed(t *testing.T) {
+	limiter := throttle.New(10, 1, 0)
+	ctx := context.Background()
+	require.NoError(t, limiter.Do(ctx, func(ctx context.Context) error { return nil }), "The burst should go right away")
+
+	stale, cancel := context.WithCancel(ctx)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	called := false
+	err := limiter.DoUnlessStale(ctx, stale, func(ctx context.Context) error {
+		called = true
+		return nil
+	})
+	require.ErrorIs(t, err, throttle.ErrShed, "A call still waiting when it goes stale should be shed")
+	require.False(t, called)
+	require.ErrorIs(t, limiter.DoUnlessStale(ctx, stale, func(ctx context.Context) error { return nil }), throttle.ErrShed,
+		"Calls that are already stale shouldn't wait")
+
+	stats := limiter.Stats()
+	require.Equal(t, uint64(2), stats.Shed)
+	require.Equal(t, uint64(1), stats.Calls, "Shed calls aren't made")
+}
+
+func TestRejected(t *testing.T) {
+	limiter := throttle.New(0, 0, 0)
+	tooMany := rpc.HTTPError{StatusCode: http.StatusTooManyRequests, Status: "429 Too Many Requests"}
+	require.Error(t, limiter.Do(context.Background(), func(ctx context.Context) error { return tooMany }))
+	require.Error(t, limiter.Do(context.Background(), func(ctx context.Context) error {
+		return errors.New("something else")
+	}))
+	require.Equal(t, uint64(1), limiter.Stats().Rejected, "Only the 429 should count as rejected")
+}
+
+func TestNilLimiter(t *testing.T) {
+	var limiter *throttle.Limiter
+	value, err := throttle.Call(context.Background(), limiter, func(ctx context.Context) (int, error) { return 42, nil })
+	require.NoError(t, err)
+	require.Equal(t, 42, value, "A nil limiter shouldn't get in the way")
+	require.Zero(t, limiter.Stats().Calls)
+}